@@ -2,6 +2,8 @@ package ably_test
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -576,3 +578,25 @@ var canceledCtx context.Context = func() context.Context {
 	cancel()
 	return ctx
 }()
+
+// acceptWebsocket hijacks the request's connection and accepts the websocket
+// opening handshake on it, for tests that stand in for a realtime server.
+// Frames are then read and written directly on the returned connection.
+func acceptWebsocket(t *testing.T, w http.ResponseWriter, r *http.Request) net.Conn {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	accept := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(accept[:])+"\r\n\r\n")
+	return conn
+}
+
+// writeWebsocketText writes a small, unfragmented text frame.
+func writeWebsocketText(conn net.Conn, text string) {
+	conn.Write(append([]byte{0x81, byte(len(text))}, text...))
+}
@@ -72,6 +72,11 @@ type Auth struct {
 	// server when Authorize is explicitly called.
 	onExplicitAuthorize func(context.Context, *TokenDetails)
 
+	// renewal is the token renewal in progress, if any, which concurrent
+	// calls to reauthorize wait for instead of requesting another token.
+	renewMtx sync.Mutex
+	renewal  *tokenRenewal
+
 	serverTimeOffset time.Duration
 
 	// ServerTimeHandler when provided this will be used to query server time.
@@ -282,7 +287,7 @@ func (a *Auth) Authorize(ctx context.Context, params *TokenParams, setOpts ...Au
 
 func (a *Auth) authorize(ctx context.Context, params *TokenParams, opts *authOptions, force bool) (*TokenDetails, error) {
 	switch tok := a.token(); {
-	case tok != nil && !force && (tok.Expires == 0 || !tok.expired(a.opts().Now())):
+	case tok != nil && !force && !a.tokenNeedsRenewal(tok):
 		return tok, nil
 	case params != nil && params.ClientID == "":
 		params.ClientID = a.clientID
@@ -314,11 +319,85 @@ func (a *Auth) authorize(ctx context.Context, params *TokenParams, opts *authOpt
 	return tok, nil
 }
 
+// tokenRenewal is the result of a token renewal, shared by all the callers
+// waiting for it.
+type tokenRenewal struct {
+	done chan struct{}
+	tok  *TokenDetails
+	err  error
+}
+
+// reauthorize requests a new token with the saved params. If a renewal is
+// already in progress, it waits for it and returns its result instead, so
+// that concurrent renewals result in a single token request.
 func (a *Auth) reauthorize(ctx context.Context) (*TokenDetails, error) {
+	a.renewMtx.Lock()
+	if r := a.renewal; r != nil {
+		a.renewMtx.Unlock()
+		select {
+		case <-r.done:
+			return r.tok, r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	r := &tokenRenewal{done: make(chan struct{})}
+	a.renewal = r
+	a.renewMtx.Unlock()
+
 	a.mtx.Lock()
-	defer a.mtx.Unlock()
 	a.log().Info("Auth: reauthorize")
-	return a.authorize(ctx, a.params, nil, true)
+	r.tok, r.err = a.authorize(ctx, a.params, nil, true)
+	a.mtx.Unlock()
+
+	a.renewMtx.Lock()
+	a.renewal = nil
+	a.renewMtx.Unlock()
+	close(r.done)
+	return r.tok, r.err
+}
+
+// serverNow returns the current time, adjusted for the server time offset
+// if it's known.
+func (a *Auth) serverNow() time.Time {
+	return a.opts().Now().Add(a.serverTimeOffset)
+}
+
+// tokenRenewalTime returns the server time at which tok is due for renewal:
+// the renewal margin before it expires, or halfway through its lifetime if
+// that's shorter than twice the margin.
+func (a *Auth) tokenRenewalTime(tok *TokenDetails) time.Time {
+	margin := a.opts().tokenRenewalMargin()
+	if tok.Issued != 0 {
+		if half := tok.ExpireTime().Sub(tok.IssueTime()) / 2; half < margin {
+			margin = half
+		}
+	}
+	return tok.ExpireTime().Add(-margin)
+}
+
+// tokenNeedsRenewal tells whether tok has expired or, if the client can renew
+// it, is due for renewal.
+func (a *Auth) tokenNeedsRenewal(tok *TokenDetails) bool {
+	if tok.Expires == 0 {
+		return false
+	}
+	if !a.isTokenRenewable() {
+		return tok.expired(a.serverNow())
+	}
+	return !a.serverNow().Before(a.tokenRenewalTime(tok))
+}
+
+// tokenRenewalDelay returns how long until the current token is due for
+// renewal. It returns false if there's no token that can be renewed.
+func (a *Auth) tokenRenewalDelay() (time.Duration, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	tok := a.token()
+	if a.method != authToken || tok == nil || tok.Expires == 0 || !a.isTokenRenewable() {
+		return 0, false
+	}
+	return a.tokenRenewalTime(tok).Sub(a.serverNow()), true
 }
 
 func (a *Auth) mergeOpts(opts *authOptions) *authOptions {
@@ -420,6 +499,12 @@ func (a *Auth) requestAuthURL(ctx context.Context, params *TokenParams, opts *au
 			return nil, a.newError(40000, err)
 		}
 		return newTokenDetails(string(token)), nil
+	case "application/jwt":
+		token, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, a.newError(40000, err)
+		}
+		return newTokenDetails(strings.TrimSpace(string(token))), nil
 	case protocolJSON, protocolMsgPack:
 		var req TokenRequest
 		var buf bytes.Buffer
@@ -480,6 +565,17 @@ func (a *Auth) opts() *clientOptions {
 	return a.client.opts
 }
 
+// currentToken returns the token string the client currently authenticates
+// with, if any.
+func (a *Auth) currentToken() string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if tok := a.token(); tok != nil {
+		return tok.Token
+	}
+	return ""
+}
+
 func (a *Auth) token() *TokenDetails {
 	return a.opts().TokenDetails
 }
@@ -0,0 +1,172 @@
+package ably
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxAuthRequestBody is the maximum size of the body of POST requests to
+// an AuthHandler.
+const maxAuthRequestBody = 64 << 10
+
+// A TokenAuthorizer decides the params of the token issued for a request to
+// an AuthHandler, typically from the user it authenticates, e.g. with a
+// session cookie. requested holds the params that the client library sent:
+// TTL, Capability and ClientID, any of which may be empty.
+//
+// The returned params are used as they are, so a TokenAuthorizer should only
+// pass on requested params it accepts. Returning an error rejects the
+// request; an *ErrorInfo sets the status code and error code of the response,
+// which otherwise are 401 and 40100.
+type TokenAuthorizer func(r *http.Request, requested TokenParams) (TokenParams, error)
+
+type authHandlerOptions struct {
+	response string
+}
+
+// An AuthHandlerOption configures an AuthHandler.
+type AuthHandlerOption func(*authHandlerOptions)
+
+// AuthHandlerWithTokenDetails makes the handler request tokens from Ably and
+// respond with their TokenDetails, instead of responding with token requests
+// that the client library then sends to Ably.
+func AuthHandlerWithTokenDetails() AuthHandlerOption {
+	return func(o *authHandlerOptions) {
+		o.response = "details"
+	}
+}
+
+// AuthHandlerWithJWT makes the handler respond with Ably JWTs, as created by
+// Auth.CreateJWT, instead of token requests.
+func AuthHandlerWithJWT() AuthHandlerOption {
+	return func(o *authHandlerOptions) {
+		o.response = "jwt"
+	}
+}
+
+// AuthHandler returns an http.Handler that serves the endpoint that client
+// libraries request tokens from when set as their AuthURL, with either GET
+// or POST as their AuthMethod.
+//
+// By default, it responds with token requests signed with the client's key.
+// authorize decides the params for each request, and so who gets a token and
+// with what capability; AuthHandler panics if it's nil.
+//
+// Failures are written as JSON-encoded ErrorInfo, which client libraries
+// report as the reason for failing to authenticate.
+func (c *REST) AuthHandler(authorize TokenAuthorizer, options ...AuthHandlerOption) http.Handler {
+	if authorize == nil {
+		panic("AuthHandler requires a TokenAuthorizer")
+	}
+	var opts authHandlerOptions
+	for _, o := range options {
+		o(&opts)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested, err := authRequestParams(r)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		params, err := authorize(r, requested)
+		if err != nil {
+			writeAuthError(w, newError(ErrUnauthorized, err))
+			return
+		}
+
+		var v interface{}
+		switch opts.response {
+		case "details":
+			v, err = c.Auth.RequestToken(r.Context(), &params)
+		case "jwt":
+			var jwt string
+			jwt, err = c.Auth.CreateJWT(&params)
+			if err == nil {
+				w.Header().Set("Content-Type", "application/jwt")
+				w.Header().Set("Cache-Control", "no-store")
+				w.Write([]byte(jwt))
+				return
+			}
+		default:
+			v, err = c.Auth.CreateTokenRequest(&params)
+		}
+		if err != nil {
+			writeAuthError(w, newError(ErrInternalError, err))
+			return
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			writeAuthError(w, newError(ErrInternalError, err))
+			return
+		}
+		w.Header().Set("Content-Type", protocolJSON)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(b)
+	})
+}
+
+// authRequestParams parses the token params from a request sent to an
+// AuthURL, as in the query for GET requests or the form-encoded body for POST
+// ones.
+func authRequestParams(r *http.Request) (TokenParams, error) {
+	var params TokenParams
+	var query url.Values
+	switch r.Method {
+	case http.MethodGet:
+		query = r.URL.Query()
+	case http.MethodPost:
+		if typ, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); typ != "application/x-www-form-urlencoded" {
+			return params, newErrorf(ErrBadRequest, "unsupported Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxAuthRequestBody))
+		if err != nil {
+			return params, newError(ErrBadRequest, err)
+		}
+		query, err = url.ParseQuery(string(b))
+		if err != nil {
+			return params, newError(ErrBadRequest, err)
+		}
+	default:
+		return params, newErrorf(ErrMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+	if s := query.Get("ttl"); s != "" {
+		ttl, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || ttl < 0 {
+			return params, newErrorf(ErrBadRequest, "invalid ttl %q", s)
+		}
+		params.TTL = ttl
+	}
+	params.Capability = strings.TrimSpace(query.Get("capability"))
+	params.ClientID = query.Get("clientId")
+	return params, nil
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	var e *ErrorInfo
+	if !errors.As(err, &e) {
+		e = newError(ErrInternalError, err)
+	}
+	status := e.StatusCode
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	body := struct {
+		Error errorInfo `json:"error"`
+	}{errorInfo{
+		StatusCode: status,
+		Code:       int(e.Code),
+		HRef:       e.HRef,
+		Message:    e.Message(),
+	}}
+	b, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", protocolJSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,174 @@
+package ably_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ably/ably-go/ably"
+)
+
+func TestREST_AuthHandler(t *testing.T) {
+	// Ably's requestToken endpoint, which issues tokens for the client ID
+	// and capability in the token request.
+	ablyTransport := httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if expected, got := "/keys/app.key/requestToken", req.URL.Path; expected != got {
+			return nil, errors.New("unexpected request to " + got)
+		}
+		var tokReq ably.TokenRequest
+		if err := json.NewDecoder(req.Body).Decode(&tokReq); err != nil {
+			return nil, err
+		}
+		if tokReq.MAC == "" {
+			return nil, errors.New("unsigned token request")
+		}
+		b, _ := json.Marshal(ably.TokenDetails{
+			Token:      "token",
+			ClientID:   tokReq.ClientID,
+			Capability: tokReq.Capability,
+			Expires:    time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond),
+		})
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "application/json")
+		rec.Write(b)
+		return rec.Result(), nil
+	})
+
+	server, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(&http.Client{Transport: ablyTransport}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize := func(r *http.Request, requested ably.TokenParams) (ably.TokenParams, error) {
+		user := r.Header.Get("X-User")
+		if user == "" {
+			return ably.TokenParams{}, errors.New("not logged in")
+		}
+		if requested.ClientID != "" && requested.ClientID != user {
+			return ably.TokenParams{}, &ably.ErrorInfo{StatusCode: 403, Code: 40300}
+		}
+		return ably.TokenParams{
+			TTL:        requested.TTL,
+			ClientID:   user,
+			Capability: ably.Capability{"chat:*": {ably.CapabilityPublish}}.String(),
+		}, nil
+	}
+
+	for _, c := range []struct {
+		name    string
+		options []ably.AuthHandlerOption
+		method  string
+	}{
+		{name: "token request with GET", method: "GET"},
+		{name: "token request with POST", method: "POST"},
+		{name: "token details", options: []ably.AuthHandlerOption{ably.AuthHandlerWithTokenDetails()}, method: "GET"},
+		{name: "JWT", options: []ably.AuthHandlerOption{ably.AuthHandlerWithJWT()}, method: "POST"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(server.AuthHandler(authorize, c.options...))
+			defer srv.Close()
+
+			client, err := ably.NewREST(
+				ably.WithAuthURL(srv.URL),
+				ably.WithAuthMethod(c.method),
+				ably.WithAuthHeaders(http.Header{"X-User": {"alice"}}),
+				ably.WithUseBinaryProtocol(false),
+				ably.WithHTTPClient(&http.Client{
+					Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						if "http://"+req.URL.Host == srv.URL {
+							return http.DefaultTransport.RoundTrip(req)
+						}
+						return ablyTransport(req)
+					}),
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := client.Auth.Authorize(context.Background(), &ably.TokenParams{ClientID: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := "alice", tok.ClientID; expected != got {
+				t.Errorf("expected client ID %q; got %q", expected, got)
+			}
+			if expected, got := `{"chat:*":["publish"]}`, tok.Capability; expected != got {
+				t.Errorf("expected capability %s; got %s", expected, got)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		handler := server.AuthHandler(authorize)
+		for _, c := range []struct {
+			name   string
+			req    *http.Request
+			status int
+			code   ably.ErrorCode
+		}{{
+			name:   "unsupported method",
+			req:    httptest.NewRequest("PUT", "/auth", nil),
+			status: 405,
+			code:   ably.ErrMethodNotAllowed,
+		}, {
+			name:   "unauthenticated",
+			req:    httptest.NewRequest("GET", "/auth", nil),
+			status: 401,
+			code:   ably.ErrUnauthorized,
+		}, {
+			name: "rejected by authorizer",
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/auth", strings.NewReader("clientId=bob"))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("X-User", "alice")
+				return req
+			}(),
+			status: 403,
+			code:   40300,
+		}, {
+			name: "invalid TTL",
+			req: func() *http.Request {
+				req := httptest.NewRequest("GET", "/auth?ttl=soon", nil)
+				req.Header.Set("X-User", "alice")
+				return req
+			}(),
+			status: 400,
+			code:   ably.ErrBadRequest,
+		}} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, c.req)
+			if rec.Code != c.status {
+				t.Errorf("%s: expected status %d; got %d", c.name, c.status, rec.Code)
+			}
+			var body struct {
+				Error struct {
+					StatusCode int
+					Code       ably.ErrorCode
+				}
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if body.Error.Code != c.code || body.Error.StatusCode != c.status {
+				t.Errorf("%s: expected error %d/%d; got %+v", c.name, c.code, c.status, body.Error)
+			}
+		}
+	})
+	t.Run("nil authorizer", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected AuthHandler to panic without an authorizer")
+			}
+		}()
+		server.AuthHandler(nil)
+	})
+}
@@ -0,0 +1,152 @@
+package ably
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TokenRevocationTarget identifies the tokens to revoke: those issued to a
+// client ID, those with a revocation key, or those with capabilities for a
+// channel.
+type TokenRevocationTarget struct {
+	// Type is the type of the target: "clientId", "revocationKey" or
+	// "channel".
+	Type string
+	// Value is the client ID, revocation key or channel name.
+	Value string
+}
+
+// RevokeClientID returns the target for the tokens issued to a client ID.
+func RevokeClientID(clientID string) TokenRevocationTarget {
+	return TokenRevocationTarget{Type: "clientId", Value: clientID}
+}
+
+// RevokeRevocationKey returns the target for the tokens with a revocation
+// key.
+func RevokeRevocationKey(key string) TokenRevocationTarget {
+	return TokenRevocationTarget{Type: "revocationKey", Value: key}
+}
+
+// RevokeChannel returns the target for the tokens with capabilities for a
+// channel.
+func RevokeChannel(name string) TokenRevocationTarget {
+	return TokenRevocationTarget{Type: "channel", Value: name}
+}
+
+func (t TokenRevocationTarget) String() string {
+	return t.Type + ":" + t.Value
+}
+
+// TokenRevocationResult is the result of revoking the tokens for a target.
+type TokenRevocationResult struct {
+	// Target is the target, as "type:value".
+	Target string
+	// IssuedBefore is the time before which revoked tokens were issued.
+	IssuedBefore time.Time
+	// AppliesAt is the time from which the revocation is enforced.
+	AppliesAt time.Time
+	// Error is the reason the tokens for the target couldn't be revoked, if
+	// so; the other fields are then unset, except for Target.
+	Error *ErrorInfo
+}
+
+type revokeTokensOptions struct {
+	issuedBefore      time.Time
+	allowReauthMargin bool
+}
+
+// A RevokeTokensOption configures a call to Auth.RevokeTokens.
+type RevokeTokensOption func(*revokeTokensOptions)
+
+// RevokeTokensWithIssuedBefore only revokes the tokens issued before the
+// given time, which defaults to the time the request is received by Ably.
+func RevokeTokensWithIssuedBefore(t time.Time) RevokeTokensOption {
+	return func(o *revokeTokensOptions) {
+		o.issuedBefore = t
+	}
+}
+
+// RevokeTokensWithAllowReauthMargin delays the enforcement of the revocation
+// by 30 seconds, which gives clients with revoked tokens the chance to get
+// new ones before they're disconnected.
+func RevokeTokensWithAllowReauthMargin() RevokeTokensOption {
+	return func(o *revokeTokensOptions) {
+		o.allowReauthMargin = true
+	}
+}
+
+type revokeTokensRequest struct {
+	Targets           []string `json:"targets" codec:"targets"`
+	IssuedBefore      int64    `json:"issuedBefore,omitempty" codec:"issuedBefore,omitempty"`
+	AllowReauthMargin bool     `json:"allowReauthMargin,omitempty" codec:"allowReauthMargin,omitempty"`
+}
+
+type revokeTokensResponse struct {
+	Results []tokenRevocationResult `json:"results" codec:"results"`
+}
+
+type tokenRevocationResult struct {
+	Target       string     `json:"target" codec:"target"`
+	IssuedBefore int64      `json:"issuedBefore,omitempty" codec:"issuedBefore,omitempty"`
+	AppliesAt    int64      `json:"appliesAt,omitempty" codec:"appliesAt,omitempty"`
+	Error        *errorInfo `json:"error,omitempty" codec:"error,omitempty"`
+}
+
+// RevokeTokens revokes the tokens issued with the client's key for the given
+// targets, and returns a result for each of them.
+//
+// Revoking tokens requires the client to have a key, which authenticates
+// the request. If the tokens for only some targets can't be revoked, the
+// reasons are set in the results' Error, and the returned error is nil.
+func (a *Auth) RevokeTokens(ctx context.Context, targets []TokenRevocationTarget, options ...RevokeTokensOption) ([]TokenRevocationResult, error) {
+	var o revokeTokensOptions
+	for _, opt := range options {
+		opt(&o)
+	}
+	keyName, keySecret := a.opts().KeyName(), a.opts().KeySecret()
+	switch {
+	case a.opts().Key == "":
+		return nil, newError(ErrInvalidCredentials, errMissingKey)
+	case keyName == "" || keySecret == "":
+		return nil, newError(ErrIncompatibleCredentials, errInvalidKey)
+	case len(targets) == 0:
+		return nil, newErrorf(ErrBadRequest, "no targets to revoke tokens for")
+	}
+
+	body := revokeTokensRequest{AllowReauthMargin: o.allowReauthMargin}
+	for _, t := range targets {
+		body.Targets = append(body.Targets, t.String())
+	}
+	if !o.issuedBefore.IsZero() {
+		body.IssuedBefore = unixMilli(o.issuedBefore)
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte(keyName + ":" + keySecret))
+	var res revokeTokensResponse
+	r := &request{
+		Method: "POST",
+		Path:   "/keys/" + url.PathEscape(keyName) + "/revokeTokens",
+		In:     &body,
+		Out:    &res,
+		NoAuth: true,
+		header: http.Header{"Authorization": {"Basic " + credentials}},
+	}
+	if _, err := a.client.doWithHandle(ctx, r, a.client.handleBatchResponse); err != nil {
+		return nil, err
+	}
+
+	results := make([]TokenRevocationResult, 0, len(res.Results))
+	for _, r := range res.Results {
+		result := TokenRevocationResult{Target: r.Target}
+		if r.Error != nil {
+			result.Error = newErrorFromProto(r.Error)
+		} else {
+			result.IssuedBefore = time.Unix(0, r.IssuedBefore*int64(time.Millisecond))
+			result.AppliesAt = time.Unix(0, r.AppliesAt*int64(time.Millisecond))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
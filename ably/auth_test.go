@@ -2,13 +2,19 @@ package ably_test
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -847,3 +853,362 @@ func TestAuth_RSA7c(t *testing.T) {
 		t.Error("expected an error")
 	}
 }
+
+func TestAuth_TokenRenewal(t *testing.T) {
+	now := time.Now()
+
+	newClient := func(authCallback func(context.Context, ably.TokenParams) (ably.Tokener, error)) (*ably.REST, *int32) {
+		var requests int32
+		client, err := ably.NewREST(
+			ably.WithAuthCallback(authCallback),
+			ably.WithTokenRenewalMargin(time.Minute),
+			ably.WithNow(func() time.Time { return now }),
+			ably.WithUseBinaryProtocol(false),
+			ably.WithHTTPClient(&http.Client{
+				Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					atomic.AddInt32(&requests, 1)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"application/json"}},
+						Body:       ioutil.NopCloser(strings.NewReader("[]")),
+					}, nil
+				}),
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client, &requests
+	}
+
+	t.Run("renews token when due before requests", func(t *testing.T) {
+		var calls int32
+		client, _ := newClient(func(ctx context.Context, params ably.TokenParams) (ably.Tokener, error) {
+			n := atomic.AddInt32(&calls, 1)
+			return &ably.TokenDetails{
+				Token:   fmt.Sprintf("token-%d", n),
+				Issued:  now.UnixNano() / int64(time.Millisecond),
+				Expires: now.Add(time.Hour).UnixNano() / int64(time.Millisecond),
+			}, nil
+		})
+
+		for _, c := range []struct {
+			elapsed time.Duration
+			calls   int32
+		}{
+			{elapsed: 0, calls: 1},
+			{elapsed: 58 * time.Minute, calls: 1},
+			// Within the renewal margin.
+			{elapsed: 59 * time.Minute, calls: 2},
+			{elapsed: 60 * time.Minute, calls: 2},
+		} {
+			now = now.Add(c.elapsed)
+			if _, err := client.Stats().Pages(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(-c.elapsed)
+			if got := atomic.LoadInt32(&calls); got != c.calls {
+				t.Fatalf("after %v: expected %d AuthCallback calls; got %d", c.elapsed, c.calls, got)
+			}
+		}
+	})
+
+	t.Run("renews short-lived tokens halfway through their lifetime", func(t *testing.T) {
+		var calls int32
+		client, _ := newClient(func(ctx context.Context, params ably.TokenParams) (ably.Tokener, error) {
+			atomic.AddInt32(&calls, 1)
+			return &ably.TokenDetails{
+				Token:   "token",
+				Issued:  now.UnixNano() / int64(time.Millisecond),
+				Expires: now.Add(time.Minute).UnixNano() / int64(time.Millisecond),
+			}, nil
+		})
+
+		for i := 0; i < 3; i++ {
+			if _, err := client.Stats().Pages(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Fatalf("expected 1 AuthCallback call; got %d", got)
+		}
+		now = now.Add(30 * time.Second)
+		if _, err := client.Stats().Pages(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Fatalf("expected 2 AuthCallback calls; got %d", got)
+		}
+	})
+
+	t.Run("collapses concurrent renewals", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		client, _ := newClient(func(ctx context.Context, params ably.TokenParams) (ably.Tokener, error) {
+			n := atomic.AddInt32(&calls, 1)
+			<-release
+			return &ably.TokenDetails{
+				Token:   fmt.Sprintf("token-%d", n),
+				Expires: now.Add(time.Hour).UnixNano() / int64(time.Millisecond),
+			}, nil
+		})
+
+		const renewals = 4
+		tokens := make(chan string, renewals)
+		for i := 0; i < renewals; i++ {
+			go func() {
+				tok, err := client.Auth.Reauthorize(context.Background())
+				if err != nil {
+					tokens <- err.Error()
+					return
+				}
+				tokens <- tok.Token
+			}()
+		}
+		ablytest.Instantly.NoRecv(t, nil, tokens, t.Fatalf)
+		close(release)
+		for i := 0; i < renewals; i++ {
+			var token string
+			ablytest.Soon.Recv(t, &token, tokens, t.Fatalf)
+			if expected := "token-1"; token != expected {
+				t.Errorf("expected %q; got %q", expected, token)
+			}
+		}
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Fatalf("expected 1 AuthCallback call; got %d", got)
+		}
+	})
+}
+
+func TestAuth_JWT(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	rest, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithNow(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := rest.Auth.CreateJWT(&ably.TokenParams{
+		TTL:        time.Hour.Milliseconds(),
+		Capability: `{"foo":["subscribe"]}`,
+		ClientID:   "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("CreateJWT signs with HS256", func(t *testing.T) {
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Fatalf("expected 3 JWT parts; got %q", jwt)
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if expected, got := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2]; expected != got {
+			t.Errorf("expected signature %q; got %q", expected, got)
+		}
+
+		var header, claims map[string]interface{}
+		for i, v := range []*map[string]interface{}{&header, &claims} {
+			b, err := base64.RawURLEncoding.DecodeString(parts[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(b, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expectedHeader := map[string]interface{}{"typ": "JWT", "alg": "HS256", "kid": "app.key"}
+		if !reflect.DeepEqual(expectedHeader, header) {
+			t.Errorf("expected header %v; got %v", expectedHeader, header)
+		}
+		expectedClaims := map[string]interface{}{
+			"iat":               float64(now.Unix()),
+			"exp":               float64(now.Add(time.Hour).Unix()),
+			"x-ably-capability": `{"foo":["subscribe"]}`,
+			"x-ably-clientId":   "alice",
+		}
+		if !reflect.DeepEqual(expectedClaims, claims) {
+			t.Errorf("expected claims %v; got %v", expectedClaims, claims)
+		}
+	})
+
+	expected := &ably.TokenDetails{
+		Token:      jwt,
+		Issued:     now.Unix() * 1000,
+		Expires:    now.Add(time.Hour).Unix() * 1000,
+		Capability: `{"foo":["subscribe"]}`,
+		ClientID:   "alice",
+	}
+
+	t.Run("details from AuthCallback TokenString", func(t *testing.T) {
+		client, err := ably.NewREST(
+			ably.WithNow(func() time.Time { return now }),
+			ably.WithAuthCallback(func(context.Context, ably.TokenParams) (ably.Tokener, error) {
+				return ably.TokenString(jwt), nil
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok, err := client.Auth.Authorize(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, tok) {
+			t.Errorf("expected %+v; got %+v", expected, tok)
+		}
+		if expected, got := "alice", client.Auth.ClientID(); expected != got {
+			t.Errorf("expected client ID %q; got %q", expected, got)
+		}
+	})
+
+	t.Run("details from AuthURL application/jwt", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/jwt")
+			w.Write([]byte(jwt))
+		}))
+		defer srv.Close()
+
+		client, err := ably.NewREST(
+			ably.WithNow(func() time.Time { return now }),
+			ably.WithAuthURL(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok, err := client.Auth.Authorize(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, tok) {
+			t.Errorf("expected %+v; got %+v", expected, tok)
+		}
+	})
+
+	t.Run("opaque tokens have no details", func(t *testing.T) {
+		client, err := ably.NewREST(
+			ably.WithAuthCallback(func(context.Context, ably.TokenParams) (ably.Tokener, error) {
+				return ably.TokenString("xVLyHw.a-opaque.token"), nil
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok, err := client.Auth.Authorize(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (&ably.TokenDetails{Token: "xVLyHw.a-opaque.token"}); !reflect.DeepEqual(expected, tok) {
+			t.Errorf("expected %+v; got %+v", expected, tok)
+		}
+	})
+}
+
+func TestAuth_RevokeTokens(t *testing.T) {
+	type request struct {
+		path string
+		auth string
+		body map[string]interface{}
+	}
+	requests := make(chan request, 1)
+	respond := func(status int, body string) ably.ClientOption {
+		return ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				r := request{path: req.URL.Path, auth: req.Header.Get("Authorization")}
+				if err := json.NewDecoder(req.Body).Decode(&r.body); err != nil {
+					return nil, err
+				}
+				requests <- r
+				return &http.Response{
+					StatusCode: status,
+					Header:     http.Header{"Content-Type": {"application/json"}},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				}, nil
+			}),
+		})
+	}
+	issuedBefore := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	appliesAt := issuedBefore.Add(30 * time.Second)
+
+	t.Run("partial failure", func(t *testing.T) {
+		client, err := ably.NewREST(
+			ably.WithKey("app.key:secret"),
+			ably.WithUseBinaryProtocol(false),
+			respond(http.StatusBadRequest, fmt.Sprintf(`{
+				"error": {"code": 40020, "statusCode": 400, "message": "Batched response includes errors"},
+				"successCount": 1,
+				"failureCount": 1,
+				"results": [
+					{"target": "clientId:alice", "issuedBefore": %d, "appliesAt": %d},
+					{"target": "channel:", "error": {"code": 40000, "statusCode": 400, "message": "invalid target"}}
+				]
+			}`, issuedBefore.UnixNano()/1e6, appliesAt.UnixNano()/1e6)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := client.Auth.RevokeTokens(context.Background(),
+			[]ably.TokenRevocationTarget{ably.RevokeClientID("alice"), ably.RevokeChannel("")},
+			ably.RevokeTokensWithIssuedBefore(issuedBefore),
+			ably.RevokeTokensWithAllowReauthMargin(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var req request
+		ablytest.Instantly.Recv(t, &req, requests, t.Fatalf)
+		if expected, got := "/keys/app.key/revokeTokens", req.path; expected != got {
+			t.Errorf("expected path %q; got %q", expected, got)
+		}
+		if expected, got := "Basic "+base64.StdEncoding.EncodeToString([]byte("app.key:secret")), req.auth; expected != got {
+			t.Errorf("expected Authorization %q; got %q", expected, got)
+		}
+		expectedBody := map[string]interface{}{
+			"targets":           []interface{}{"clientId:alice", "channel:"},
+			"issuedBefore":      float64(issuedBefore.UnixNano() / 1e6),
+			"allowReauthMargin": true,
+		}
+		if !reflect.DeepEqual(expectedBody, req.body) {
+			t.Errorf("expected body %v; got %v", expectedBody, req.body)
+		}
+
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results; got %+v", results)
+		}
+		if r := results[0]; r.Target != "clientId:alice" || r.Error != nil ||
+			!r.IssuedBefore.Equal(issuedBefore) || !r.AppliesAt.Equal(appliesAt) {
+			t.Errorf("unexpected success result: %+v", r)
+		}
+		if r := results[1]; r.Target != "channel:" || r.Error == nil || r.Error.Code != 40000 {
+			t.Errorf("unexpected failure result: %+v", r)
+		}
+	})
+
+	t.Run("request failure", func(t *testing.T) {
+		client, err := ably.NewREST(
+			ably.WithKey("app.key:secret"),
+			ably.WithUseBinaryProtocol(false),
+			respond(http.StatusUnauthorized, `{"error": {"code": 40160, "statusCode": 401, "message": "not permitted"}}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Auth.RevokeTokens(context.Background(), []ably.TokenRevocationTarget{ably.RevokeRevocationKey("group")})
+		if expected, got := ably.ErrorCode(40160), ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d; got %v", expected, err)
+		}
+		ablytest.Instantly.Recv(t, nil, requests, t.Fatalf)
+	})
+
+	t.Run("requires a key", func(t *testing.T) {
+		client, err := ably.NewREST(ably.WithToken("token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Auth.RevokeTokens(context.Background(), []ably.TokenRevocationTarget{ably.RevokeClientID("alice")})
+		if expected, got := ably.ErrInvalidCredentials, ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d; got %v", expected, err)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package ably
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A CapabilityOperation is an operation that a capability can allow on a
+// resource.
+type CapabilityOperation string
+
+const (
+	// CapabilityAll allows every operation.
+	CapabilityAll               CapabilityOperation = "*"
+	CapabilityPublish           CapabilityOperation = "publish"
+	CapabilitySubscribe         CapabilityOperation = "subscribe"
+	CapabilityPresence          CapabilityOperation = "presence"
+	CapabilityHistory           CapabilityOperation = "history"
+	CapabilityStats             CapabilityOperation = "stats"
+	CapabilityChannelMetadata   CapabilityOperation = "channel-metadata"
+	CapabilityPushSubscribe     CapabilityOperation = "push-subscribe"
+	CapabilityPushAdmin         CapabilityOperation = "push-admin"
+	CapabilityPrivilegedHeaders CapabilityOperation = "privileged-headers"
+)
+
+var capabilityOperations = map[CapabilityOperation]bool{
+	CapabilityAll:               true,
+	CapabilityPublish:           true,
+	CapabilitySubscribe:         true,
+	CapabilityPresence:          true,
+	CapabilityHistory:           true,
+	CapabilityStats:             true,
+	CapabilityChannelMetadata:   true,
+	CapabilityPushSubscribe:     true,
+	CapabilityPushAdmin:         true,
+	CapabilityPrivilegedHeaders: true,
+}
+
+// A Capability maps resources to the operations allowed on them. It's
+// marshaled to and from JSON as Ably expects it, e.g. to set
+// TokenParams.Capability with its String method.
+//
+// A resource is either a channel name or a pattern:
+//
+//   - "*" matches every channel;
+//   - "namespace:*" matches every channel in the namespace;
+//   - "[*]*" matches every resource, including qualified ones like
+//     "[meta]channel.lifecycle".
+type Capability map[string][]CapabilityOperation
+
+// ParseCapability parses and validates a JSON-encoded capability, as found
+// in TokenParams.Capability and TokenDetails.Capability.
+func ParseCapability(s string) (Capability, error) {
+	var c Capability
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return nil, newErrorf(ErrBadRequest, "invalid capability %q: %v", s, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// String returns the JSON encoding of the capability.
+func (c Capability) String() string {
+	if c == nil {
+		c = Capability{}
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// Validate checks that every resource is named and has known operations.
+func (c Capability) Validate() error {
+	for resource, ops := range c {
+		if resource == "" {
+			return newErrorf(ErrBadRequest, "invalid capability: empty resource name")
+		}
+		if len(ops) == 0 {
+			return newErrorf(ErrBadRequest, "invalid capability: no operations for resource %q", resource)
+		}
+		for _, op := range ops {
+			if !capabilityOperations[op] {
+				return newErrorf(ErrBadRequest, "invalid capability: unknown operation %q for resource %q", op, resource)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows tells whether the capability allows an operation on a resource,
+// usually a channel name.
+func (c Capability) Allows(resource string, op CapabilityOperation) bool {
+	for pattern, ops := range c {
+		if resourceMatches(pattern, resource) && operationsInclude(ops, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns the capability that allows only what both c and other
+// allow, as Ably does with the capability requested for a token and the
+// capability of the key that issues it.
+func (c Capability) Intersect(other Capability) Capability {
+	result := Capability{}
+	for a, aOps := range c {
+		for b, bOps := range other {
+			var resource string
+			switch {
+			case resourceMatches(b, a):
+				resource = a
+			case resourceMatches(a, b):
+				resource = b
+			default:
+				continue
+			}
+			for _, op := range intersectOperations(aOps, bOps) {
+				if !operationsInclude(result[resource], op) {
+					result[resource] = append(result[resource], op)
+				}
+			}
+		}
+	}
+	for resource, ops := range result {
+		if operationsInclude(ops, CapabilityAll) {
+			result[resource] = []CapabilityOperation{CapabilityAll}
+			continue
+		}
+		sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	}
+	return result
+}
+
+// resourceMatches tells whether pattern matches resource, which may be a
+// pattern itself.
+func resourceMatches(pattern, resource string) bool {
+	switch {
+	case pattern == resource, pattern == "[*]*":
+		return true
+	case strings.HasPrefix(resource, "["):
+		// Qualified resources only match patterns with the same qualifier.
+		i := strings.Index(pattern, "]")
+		j := strings.Index(resource, "]")
+		if i == -1 || j == -1 || pattern[:i] != resource[:j] {
+			return false
+		}
+		return resourceMatches(pattern[i+1:], resource[j+1:])
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, ":*"):
+		return strings.HasPrefix(resource, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+func operationsInclude(ops []CapabilityOperation, op CapabilityOperation) bool {
+	for _, o := range ops {
+		if o == op || o == CapabilityAll {
+			return true
+		}
+	}
+	return false
+}
+
+func intersectOperations(a, b []CapabilityOperation) []CapabilityOperation {
+	var ops []CapabilityOperation
+	for _, op := range a {
+		if operationsInclude(b, op) {
+			ops = append(ops, op)
+		}
+	}
+	for _, op := range b {
+		if operationsInclude(a, op) {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// checkCapability fails fast if the capability of the token the client
+// authenticates with is known not to allow an operation on a channel, which
+// Ably would otherwise reject.
+func (a *Auth) checkCapability(channel string, op CapabilityOperation) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	tok := a.token()
+	if a.method != authToken || tok == nil || tok.Capability == "" || a.tokenNeedsRenewal(tok) {
+		// The token the operation is performed with will be renewed, maybe
+		// with a different capability.
+		return nil
+	}
+	c, err := ParseCapability(tok.Capability)
+	if err != nil {
+		// Let Ably decide.
+		return nil
+	}
+	if !c.Allows(channel, op) {
+		return newError(ErrOperationNotPermittedWithProvidedCapability,
+			fmt.Errorf("token capability %s doesn't allow %s on channel %q", tok.Capability, op, channel))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package ably_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ably/ably-go/ably"
+)
+
+func TestCapability_JSON(t *testing.T) {
+	c, err := ably.ParseCapability(`{"chat:*":["publish","subscribe"],"notifications":["subscribe"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ably.Capability{
+		"chat:*":        {ably.CapabilityPublish, ably.CapabilitySubscribe},
+		"notifications": {ably.CapabilitySubscribe},
+	}
+	if !reflect.DeepEqual(expected, c) {
+		t.Fatalf("expected %v; got %v", expected, c)
+	}
+	if expected, got := `{"chat:*":["publish","subscribe"],"notifications":["subscribe"]}`, c.String(); expected != got {
+		t.Errorf("expected %s; got %s", expected, got)
+	}
+
+	b, err := json.Marshal(ably.TokenParams{Capability: c.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := `{"capability":"{\"chat:*\":[\"publish\",\"subscribe\"],\"notifications\":[\"subscribe\"]}"}`, string(b); expected != got {
+		t.Errorf("expected %s; got %s", expected, got)
+	}
+
+	for _, invalid := range []string{
+		`not json`,
+		`["publish"]`,
+		`{"":["publish"]}`,
+		`{"chat":[]}`,
+		`{"chat":["publsh"]}`,
+	} {
+		if _, err := ably.ParseCapability(invalid); err == nil {
+			t.Errorf("expected error parsing %s", invalid)
+		}
+	}
+}
+
+func TestCapability_Allows(t *testing.T) {
+	c := ably.Capability{
+		"*":               {ably.CapabilitySubscribe},
+		"chat:*":          {ably.CapabilityPublish, ably.CapabilityPresence},
+		"admin":           {ably.CapabilityAll},
+		"[meta]log":       {ably.CapabilitySubscribe},
+		"[?rewind=1]feed": {ably.CapabilityHistory},
+	}
+	for _, tc := range []struct {
+		resource string
+		op       ably.CapabilityOperation
+		allowed  bool
+	}{
+		{"news", ably.CapabilitySubscribe, true},
+		{"news", ably.CapabilityPublish, false},
+		{"chat:room", ably.CapabilityPublish, true},
+		{"chat:room", ably.CapabilitySubscribe, true},
+		{"chat:room", ably.CapabilityHistory, false},
+		{"chatroom", ably.CapabilityPublish, false},
+		{"admin", ably.CapabilityPushAdmin, true},
+		{"[meta]log", ably.CapabilitySubscribe, true},
+		{"[meta]other", ably.CapabilitySubscribe, false},
+		{"[?rewind=1]feed", ably.CapabilityHistory, true},
+	} {
+		if got := c.Allows(tc.resource, tc.op); got != tc.allowed {
+			t.Errorf("Allows(%q, %q): expected %v; got %v", tc.resource, tc.op, tc.allowed, got)
+		}
+	}
+
+	if !(ably.Capability{"[*]*": {ably.CapabilitySubscribe}}).Allows("[meta]log", ably.CapabilitySubscribe) {
+		t.Errorf("expected [*]* to match qualified resources")
+	}
+}
+
+func TestCapability_Intersect(t *testing.T) {
+	key := ably.Capability{
+		"*":      {ably.CapabilitySubscribe, ably.CapabilityHistory},
+		"chat:*": {ably.CapabilityAll},
+	}
+	requested := ably.Capability{
+		"*":         {ably.CapabilityAll},
+		"chat:room": {ably.CapabilityPublish, ably.CapabilityPresence},
+		// The key doesn't allow publishing on news.
+		"news": {ably.CapabilityPublish},
+	}
+	expected := ably.Capability{
+		"*":         {ably.CapabilityHistory, ably.CapabilitySubscribe},
+		"chat:*":    {ably.CapabilityAll},
+		"chat:room": {ably.CapabilityPresence, ably.CapabilityPublish},
+	}
+	if got := key.Intersect(requested); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+	if got := requested.Intersect(key); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+}
+
+func TestCapability_FailFast(t *testing.T) {
+	token := &ably.TokenDetails{
+		Token:      "token",
+		Capability: `{"chat:*":["subscribe"]}`,
+	}
+	client := &http.Client{
+		Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("unexpected request")
+		}),
+	}
+
+	rest, err := ably.NewREST(ably.WithTokenDetails(token), ably.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.Channels.Get("chat:room").Publish(context.Background(), "event", "data")
+	if expected, got := ably.ErrOperationNotPermittedWithProvidedCapability, ably.UnwrapErrorCode(err); expected != got {
+		t.Errorf("expected error code %d; got %v", expected, err)
+	}
+
+	realtime, err := ably.NewRealtime(ably.WithTokenDetails(token), ably.WithAutoConnect(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer realtime.Close()
+	channel := realtime.Channels.Get("chat:room")
+	err = channel.Publish(context.Background(), "event", "data")
+	if expected, got := ably.ErrOperationNotPermittedWithProvidedCapability, ably.UnwrapErrorCode(err); expected != got {
+		t.Errorf("expected error code %d; got %v", expected, err)
+	}
+	err = channel.Presence.EnterClient(context.Background(), "alice", "data")
+	if expected, got := ably.ErrOperationNotPermittedWithProvidedCapability, ably.UnwrapErrorCode(err); expected != got {
+		t.Errorf("expected error code %d; got %v", expected, err)
+	}
+	if expected, got := ably.ChannelStateInitialized, channel.State(); expected != got {
+		t.Errorf("expected channel to stay %v; got %v", expected, got)
+	}
+}
@@ -0,0 +1,337 @@
+package ably
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// CometMode sets when Realtime clients connect through the Comet transport,
+// which exchanges protocol messages through HTTP long polling instead of a
+// websocket.
+type CometMode uint
+
+const (
+	// CometModeFallback makes Realtime clients connect through Comet after
+	// websocket connections keep failing, e.g. because a proxy doesn't allow
+	// websocket upgrades. This is the default.
+	CometModeFallback CometMode = iota
+	// CometModeDisabled makes Realtime clients always connect through
+	// websockets.
+	CometModeDisabled
+	// CometModeForced makes Realtime clients always connect through Comet.
+	CometModeForced
+)
+
+// cometFallbackThreshold is the number of consecutive failed websocket
+// connection attempts after which Realtime clients fall back to Comet.
+const cometFallbackThreshold = 2
+
+// cometAuthParams are the query parameters from the initial connection
+// request that are passed along with every subsequent request.
+var cometAuthParams = []string{"key", "access_token", "format"}
+
+// cometConn is a conn that exchanges protocol messages with Ably's Comet
+// endpoints: messages are received by long polling the recv endpoint and
+// sent by posting them to the send endpoint.
+type cometConn struct {
+	client *http.Client
+	// recvClient is client without its overall timeout, which would abort
+	// recv long polls; they're bound by Receive's deadline instead.
+	recvClient *http.Client
+	proto      string
+	base       url.URL
+	params     url.Values
+	timeout    time.Duration
+
+	// ctx is canceled when the connection is closed, aborting any pending
+	// requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx sync.Mutex
+	key string
+	// pending holds messages received from any endpoint and not yet returned
+	// by Receive.
+	pending []*protocolMessage
+
+	// queued is signaled when Send adds messages to pending, so that Receive
+	// doesn't wait for the recv long poll to return them.
+	queued chan struct{}
+	// recv delivers the result of the recv request in flight, if any. It's
+	// only accessed by Receive.
+	recv chan cometRecvResult
+}
+
+type cometRecvResult struct {
+	msgs []*protocolMessage
+	err  error
+}
+
+// dialComet opens a Comet connection, given the URL for a websocket
+// connection.
+func dialComet(client *http.Client, proto string, u *url.URL, timeout time.Duration) (conn, error) {
+	base := *u
+	switch base.Scheme {
+	case "ws":
+		base.Scheme = "http"
+	case "wss":
+		base.Scheme = "https"
+	}
+	base.Path = ""
+	base.RawQuery = ""
+
+	query := u.Query()
+	params := url.Values{}
+	for _, k := range cometAuthParams {
+		if v, ok := query[k]; ok {
+			params[k] = v
+		}
+	}
+	query.Set("stream", "false")
+
+	recvClient := *client
+	recvClient.Timeout = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cometConn{
+		client:     client,
+		recvClient: &recvClient,
+		proto:      proto,
+		base:       base,
+		params:     params,
+		timeout:    timeout,
+		ctx:        ctx,
+		cancel:     cancel,
+		queued:     make(chan struct{}, 1),
+	}
+
+	connectCtx, cancelConnect := context.WithTimeout(ctx, timeout)
+	defer cancelConnect()
+	msgs, err := c.request(connectCtx, c.client, http.MethodGet, "/comet/connect", query, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.pending = msgs
+	return c, nil
+}
+
+func (c *cometConn) Send(msg *protocolMessage) error {
+	body, err := encode(c.proto, []*protocolMessage{msg})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	msgs, err := c.request(ctx, c.client, http.MethodPost, c.path("send"), c.params, body)
+	if err != nil {
+		return err
+	}
+	// The response to a send request may hold messages too; they're returned
+	// by Receive along with those from recv.
+	if len(msgs) > 0 {
+		c.queue(msgs)
+		select {
+		case c.queued <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Receive returns the next pending message, long polling the recv endpoint
+// until there's one. A recv request still in flight when Send queues
+// messages is left for the next call, so that none of the messages it
+// returns are lost.
+func (c *cometConn) Receive(deadline time.Time) (*protocolMessage, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		if msg := c.dequeue(); msg != nil {
+			return msg, nil
+		}
+		if c.recv == nil {
+			recv := make(chan cometRecvResult, 1)
+			c.recv = recv
+			go func() {
+				msgs, err := c.request(c.ctx, c.recvClient, http.MethodGet, c.path("recv"), c.params, nil)
+				recv <- cometRecvResult{msgs: msgs, err: err}
+			}()
+		}
+		select {
+		case r := <-c.recv:
+			c.recv = nil
+			if r.err != nil {
+				return nil, r.err
+			}
+			c.queue(r.msgs)
+		case <-c.queued:
+		case <-timeout:
+			return nil, context.DeadlineExceeded
+		}
+	}
+}
+
+func (c *cometConn) queue(msgs []*protocolMessage) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.pending = append(c.pending, msgs...)
+}
+
+func (c *cometConn) dequeue() *protocolMessage {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	msg := c.pending[0]
+	c.pending = c.pending[1:]
+	return msg
+}
+
+func (c *cometConn) Close() error {
+	c.cancel()
+	if c.connectionKey() == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_, err := c.request(ctx, c.client, http.MethodGet, c.path("close"), c.params, nil)
+	return err
+}
+
+func (c *cometConn) connectionKey() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.key
+}
+
+func (c *cometConn) path(endpoint string) string {
+	return "/comet/" + url.PathEscape(c.connectionKey()) + "/" + endpoint
+}
+
+// request makes a request to a Comet endpoint with the given client and
+// decodes the protocol messages from the response.
+func (c *cometConn) request(ctx context.Context, client *http.Client, method, path string, query url.Values, body []byte) ([]*protocolMessage, error) {
+	u := c.base
+	u.Path = path
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", c.proto)
+	if body != nil {
+		req.Header.Set("Content-Type", c.proto)
+	}
+	req.Header.Set(ablyAgentHeader, ablyAgentIdentifier)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValidHTTPResponse(resp); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, nil
+	}
+	var msgs []*protocolMessage
+	if err := decode(c.proto, bytes.NewReader(b), &msgs); err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.Action != actionConnected {
+			continue
+		}
+		key := msg.ConnectionKey
+		if msg.ConnectionDetails != nil && msg.ConnectionDetails.ConnectionKey != "" {
+			key = msg.ConnectionDetails.ConnectionKey
+		}
+		c.mtx.Lock()
+		c.key = key
+		c.mtx.Unlock()
+	}
+	return msgs, nil
+}
+
+// dialCometHost opens a Comet connection to the given realtime host.
+func (c *Connection) dialCometHost(proto, host string, query url.Values) (conn, error) {
+	u, err := url.Parse(c.opts.realtimeURLForHost(host))
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("heartbeats", "true") // RTN23b
+	u.RawQuery = q.Encode()
+
+	c.log().Debugf("Dial Comet protocol=%q url %q ", proto, u.String())
+	return dialComet(c.opts.httpclient(), proto, u, c.opts.realtimeRequestTimeout())
+}
+
+// canFallBackToComet records a failed websocket connection attempt, and
+// returns whether the connection should then be tried through Comet.
+//
+// Only the default websocket transport falls back to Comet; custom
+// transports are used as they are.
+func (c *Connection) canFallBackToComet(err error) bool {
+	if c.opts.CometMode != CometModeFallback || c.opts.Dial != nil || c.opts.Transport != nil {
+		return false
+	}
+	var e *ErrorInfo
+	if errors.As(err, &e) && !canFallBack(e.StatusCode) {
+		return false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.websocketFailures++
+	return c.websocketFailures >= cometFallbackThreshold
+}
+
+// dialRealtime opens a connection to the given realtime host, through the
+// transport set by CometMode.
+func (c *Connection) dialRealtime(proto, host string, query url.Values) (conn, error) {
+	if c.opts.CometMode == CometModeForced {
+		return c.dialCometHost(proto, host, query)
+	}
+
+	conn, err := c.dialHost(proto, host, query)
+	if err != nil && canFallBackRealtime(err) {
+		conn, err = c.dialFallbacks(proto, host, query, err)
+	}
+	if err == nil {
+		c.mtx.Lock()
+		c.websocketFailures = 0
+		c.mtx.Unlock()
+		return conn, nil
+	}
+	if !c.canFallBackToComet(err) {
+		return nil, err
+	}
+	c.log().Warnf("Websocket connections keep failing (%v); trying Comet transport", err)
+	return c.dialCometHost(proto, host, query)
+}
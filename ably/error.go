@@ -10,6 +10,10 @@ import (
 	"strings"
 )
 
+// errDeltaDecodeFailure is the code for failures decoding a delta message
+// (RTL18b). It's missing from the generated error codes.
+const errDeltaDecodeFailure ErrorCode = 40018
+
 func (code ErrorCode) toStatusCode() int {
 	switch status := int(code) / 100; status {
 	case
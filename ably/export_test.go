@@ -73,6 +73,10 @@ func (c *REST) Timestamp(query bool) (time.Time, error) {
 	return c.Auth.timestamp(context.Background(), query)
 }
 
+func (a *Auth) Reauthorize(ctx context.Context) (*TokenDetails, error) {
+	return a.reauthorize(ctx)
+}
+
 func (a *Auth) SetServerTimeFunc(st func() (time.Time, error)) {
 	a.serverTimeHandler = st
 }
@@ -225,6 +229,7 @@ const (
 	ActionPresence     = actionPresence
 	ActionMessage      = actionMessage
 	ActionSync         = actionSync
+	ActionAuth         = actionAuth
 
 	FlagHasPresence       = flagHasPresence
 	FlagHasBacklog        = flagHasBacklog
@@ -257,7 +262,7 @@ func ChannelModeToFlag(mode ChannelMode) ProtoFlag {
 }
 
 func DialWebsocket(proto string, u *url.URL, timeout time.Duration) (Conn, error) {
-	return dialWebsocket(proto, u, timeout)
+	return dialTransport(websocketTransport(&clientOptions{}), proto, u, timeout)
 }
 
 func NewCBCCipher(opts CipherParams) (*cbcCipher, error) {
@@ -0,0 +1,421 @@
+// Package vcdiff implements a decoder for the VCDIFF generic differencing and
+// compression data format, as described in RFC 3284, which Ably uses for
+// delta messages.
+//
+// Only the default code table is supported, without secondary compression,
+// which is what Ably's delta encoder produces. The Adler-32 checksum
+// extension to the window header, from xdelta3 and open-vcdiff, is supported.
+package vcdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/adler32"
+)
+
+var magic = []byte{0xd6, 0xc3, 0xc4, 0x00}
+
+// Header indicator bits.
+const (
+	hdrDecompress = 1 << 0
+	hdrCodeTable  = 1 << 1
+	hdrAppHeader  = 1 << 2
+)
+
+// Window indicator bits.
+const (
+	winSource  = 1 << 0
+	winTarget  = 1 << 1
+	winAdler32 = 1 << 2
+)
+
+// Instruction types.
+const (
+	instNoop = iota
+	instAdd
+	instRun
+	instCopy
+)
+
+// Address cache sizes for the default code table.
+const (
+	nearSize = 4
+	sameSize = 3
+)
+
+// maxWindowSize is the maximum size of a target window, which is far more
+// than Ably messages can hold. It prevents malformed deltas from making the
+// decoder allocate arbitrarily large buffers.
+const maxWindowSize = 64 << 20
+
+var (
+	errTruncated = errors.New("vcdiff: truncated delta")
+	errOverflow  = errors.New("vcdiff: integer overflow")
+)
+
+// Decode applies delta to source, returning the target.
+func Decode(source, delta []byte) ([]byte, error) {
+	r := reader{b: delta}
+	if !bytes.HasPrefix(delta, magic) {
+		return nil, errors.New("vcdiff: invalid magic bytes")
+	}
+	r.pos = len(magic)
+
+	indicator, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if indicator&hdrDecompress != 0 {
+		return nil, errors.New("vcdiff: secondary compression isn't supported")
+	}
+	if indicator&hdrCodeTable != 0 {
+		return nil, errors.New("vcdiff: application-defined code tables aren't supported")
+	}
+	if indicator&hdrAppHeader != 0 {
+		n, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.bytes(n); err != nil {
+			return nil, err
+		}
+	}
+
+	var target []byte
+	for r.pos < len(r.b) {
+		target, err = decodeWindow(&r, source, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+// decodeWindow decodes the next window from r, appending its target window to
+// target.
+func decodeWindow(r *reader, source, target []byte) ([]byte, error) {
+	indicator, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	var segment []byte
+	if indicator&(winSource|winTarget) != 0 {
+		if indicator&winSource != 0 && indicator&winTarget != 0 {
+			return nil, errors.New("vcdiff: invalid window indicator")
+		}
+		size, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		pos, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		from := source
+		if indicator&winTarget != 0 {
+			from = target
+		}
+		// Written so that it can't overflow.
+		if pos > len(from) || size > len(from)-pos {
+			return nil, fmt.Errorf("vcdiff: source segment of length %d at %d out of bounds (length %d)", size, pos, len(from))
+		}
+		segment = from[pos : pos+size]
+	}
+
+	deltaLen, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	if deltaLen > len(r.b)-r.pos {
+		return nil, errTruncated
+	}
+	end := r.pos + deltaLen
+
+	targetLen, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	if targetLen > maxWindowSize {
+		return nil, fmt.Errorf("vcdiff: target window length %d exceeds maximum %d", targetLen, maxWindowSize)
+	}
+	deltaIndicator, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if deltaIndicator != 0 {
+		return nil, errors.New("vcdiff: compressed sections aren't supported")
+	}
+	dataLen, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	instLen, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	addrLen, err := r.int()
+	if err != nil {
+		return nil, err
+	}
+	var checksum uint32
+	if indicator&winAdler32 != 0 {
+		b, err := r.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+		checksum = uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	}
+	data, err := r.bytes(dataLen)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := r.bytes(instLen)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := r.bytes(addrLen)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != end {
+		return nil, errors.New("vcdiff: inconsistent delta encoding length")
+	}
+
+	w := window{
+		segment:   segment,
+		target:    make([]byte, 0, targetLen),
+		targetLen: targetLen,
+		data:      reader{b: data},
+		inst:      reader{b: inst},
+		addr:      reader{b: addr},
+	}
+	if err := w.decode(); err != nil {
+		return nil, err
+	}
+	if len(w.target) != targetLen {
+		return nil, fmt.Errorf("vcdiff: decoded window has length %d, expected %d", len(w.target), targetLen)
+	}
+	if indicator&winAdler32 != 0 && adler32.Checksum(w.target) != checksum {
+		return nil, errors.New("vcdiff: checksum mismatch")
+	}
+	return append(target, w.target...), nil
+}
+
+type window struct {
+	segment   []byte
+	target    []byte
+	targetLen int
+	data      reader
+	inst      reader
+	addr      reader
+
+	near     [nearSize]int
+	nextNear int
+	same     [sameSize * 256]int
+}
+
+func (w *window) decode() error {
+	for w.inst.pos < len(w.inst.b) {
+		index, err := w.inst.byte()
+		if err != nil {
+			return err
+		}
+		for _, i := range defaultCodeTable[index] {
+			if i.typ == instNoop {
+				continue
+			}
+			size := int(i.size)
+			if size == 0 {
+				size, err = w.inst.int()
+				if err != nil {
+					return err
+				}
+			}
+			if err := w.execute(i.typ, size, i.mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *window) execute(typ byte, size int, mode byte) error {
+	if size > w.targetLen-len(w.target) {
+		return fmt.Errorf("vcdiff: instruction of size %d exceeds target window length %d", size, w.targetLen)
+	}
+	switch typ {
+	case instAdd:
+		b, err := w.data.bytes(size)
+		if err != nil {
+			return err
+		}
+		w.target = append(w.target, b...)
+	case instRun:
+		b, err := w.data.byte()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			w.target = append(w.target, b)
+		}
+	case instCopy:
+		here := len(w.segment) + len(w.target)
+		addr, err := w.decodeAddr(here, mode)
+		if err != nil {
+			return err
+		}
+		// Copy byte by byte, since the copied range may overlap the
+		// bytes being appended to the target.
+		for i := 0; i < size; i++ {
+			if addr < len(w.segment) {
+				w.target = append(w.target, w.segment[addr])
+			} else {
+				t := addr - len(w.segment)
+				if t >= len(w.target) {
+					return fmt.Errorf("vcdiff: invalid COPY address %d", addr)
+				}
+				w.target = append(w.target, w.target[t])
+			}
+			addr++
+		}
+	}
+	return nil
+}
+
+func (w *window) decodeAddr(here int, mode byte) (int, error) {
+	var addr int
+	switch {
+	case mode == 0: // VCD_SELF
+		v, err := w.addr.int()
+		if err != nil {
+			return 0, err
+		}
+		addr = v
+	case mode == 1: // VCD_HERE
+		v, err := w.addr.int()
+		if err != nil {
+			return 0, err
+		}
+		addr = here - v
+	case int(mode) < 2+nearSize:
+		v, err := w.addr.int()
+		if err != nil {
+			return 0, err
+		}
+		addr = w.near[mode-2] + v
+	default:
+		b, err := w.addr.byte()
+		if err != nil {
+			return 0, err
+		}
+		addr = w.same[(int(mode)-(2+nearSize))*256+int(b)]
+	}
+	// Check before caching, since the caches are indexed by address.
+	if addr < 0 || addr >= here {
+		return 0, fmt.Errorf("vcdiff: invalid COPY address %d", addr)
+	}
+	w.near[w.nextNear] = addr
+	w.nextNear = (w.nextNear + 1) % nearSize
+	w.same[addr%len(w.same)] = addr
+	return addr, nil
+}
+
+type reader struct {
+	b   []byte
+	pos int
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errTruncated
+	}
+	b := r.b[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b)-r.pos {
+		return nil, errTruncated
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// int reads a variable-length integer, as described in RFC 3284 section 2.
+func (r *reader) int() (int, error) {
+	var v uint64
+	for i := 0; ; i++ {
+		if i == 9 {
+			return 0, errOverflow
+		}
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if v > uint64(int(^uint(0)>>1)) {
+		return 0, errOverflow
+	}
+	return int(v), nil
+}
+
+type instruction struct {
+	typ  byte
+	size byte
+	mode byte
+}
+
+// defaultCodeTable is the default instruction code table, as described in
+// RFC 3284 section 5.6.
+var defaultCodeTable = func() (table [256][2]instruction) {
+	i := 0
+	next := func(first, second instruction) {
+		table[i] = [2]instruction{first, second}
+		i++
+	}
+	noop := instruction{typ: instNoop}
+
+	next(instruction{typ: instRun}, noop)
+	for size := 0; size <= 17; size++ {
+		next(instruction{typ: instAdd, size: byte(size)}, noop)
+	}
+	for mode := 0; mode < 2+nearSize+sameSize; mode++ {
+		next(instruction{typ: instCopy, mode: byte(mode)}, noop)
+		for size := 4; size <= 18; size++ {
+			next(instruction{typ: instCopy, size: byte(size), mode: byte(mode)}, noop)
+		}
+	}
+	for mode := 0; mode < 2+nearSize; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			for copySize := 4; copySize <= 6; copySize++ {
+				next(
+					instruction{typ: instAdd, size: byte(addSize)},
+					instruction{typ: instCopy, size: byte(copySize), mode: byte(mode)},
+				)
+			}
+		}
+	}
+	for mode := 2 + nearSize; mode < 2+nearSize+sameSize; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			next(
+				instruction{typ: instAdd, size: byte(addSize)},
+				instruction{typ: instCopy, size: 4, mode: byte(mode)},
+			)
+		}
+	}
+	for mode := 0; mode < 2+nearSize+sameSize; mode++ {
+		next(
+			instruction{typ: instCopy, size: 4, mode: byte(mode)},
+			instruction{typ: instAdd, size: 1},
+		)
+	}
+	return table
+}()
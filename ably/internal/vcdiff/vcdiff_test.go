@@ -0,0 +1,263 @@
+package vcdiff
+
+import (
+	"bytes"
+	"hash/adler32"
+	"strings"
+	"testing"
+)
+
+func varint(v int) []byte {
+	b := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+type testWindow struct {
+	indicator    byte
+	segment      [2]int // size, position
+	target       string
+	targetLen    int // overrides len(target) if set
+	data         string
+	inst         []byte
+	addr         []byte
+	withChecksum bool
+	checksum     uint32
+}
+
+func (w testWindow) bytes() []byte {
+	targetLen := len(w.target)
+	if w.targetLen != 0 {
+		targetLen = w.targetLen
+	}
+	var enc []byte
+	enc = append(enc, varint(targetLen)...)
+	enc = append(enc, 0) // Delta_Indicator
+	enc = append(enc, varint(len(w.data))...)
+	enc = append(enc, varint(len(w.inst))...)
+	enc = append(enc, varint(len(w.addr))...)
+	indicator := w.indicator
+	if w.withChecksum {
+		indicator |= winAdler32
+		c := w.checksum
+		if c == 0 {
+			c = adler32.Checksum([]byte(w.target))
+		}
+		enc = append(enc, byte(c>>24), byte(c>>16), byte(c>>8), byte(c))
+	}
+	enc = append(enc, w.data...)
+	enc = append(enc, w.inst...)
+	enc = append(enc, w.addr...)
+
+	b := []byte{indicator}
+	if indicator&(winSource|winTarget) != 0 {
+		b = append(b, varint(w.segment[0])...)
+		b = append(b, varint(w.segment[1])...)
+	}
+	b = append(b, varint(len(enc))...)
+	return append(b, enc...)
+}
+
+func delta(windows ...testWindow) []byte {
+	b := append([]byte{}, magic...)
+	b = append(b, 0) // Hdr_Indicator
+	for _, w := range windows {
+		b = append(b, w.bytes()...)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	source := []byte("hello world")
+
+	for _, c := range []struct {
+		name     string
+		source   []byte
+		delta    []byte
+		expected string
+	}{{
+		name:     "ADD and COPY from source",
+		expected: "hello there world",
+		source:   source,
+		delta: delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello there world",
+			data:      "there ",
+			// COPY 6 mode 0, ADD 6, COPY 5 mode 0
+			inst: []byte{22, 7, 21},
+			addr: []byte{0, 6},
+		}),
+	}, {
+		name:     "explicit sizes and RUN",
+		expected: "hello" + strings.Repeat("!", 20),
+		source:   source,
+		delta: delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello" + strings.Repeat("!", 20),
+			data:      "!",
+			// COPY size 5 mode 0, RUN size 20
+			inst: append([]byte{19, 5, 0}, varint(20)...),
+			addr: []byte{0},
+		}),
+	}, {
+		name:     "overlapping COPY within target",
+		expected: "abcabcabcabc",
+		delta: delta(testWindow{
+			target: "abcabcabcabc",
+			data:   "abc",
+			// ADD 3, COPY 9 mode 0
+			inst: []byte{4, 25},
+			addr: []byte{0},
+		}),
+	}, {
+		name:     "address cache modes",
+		expected: "helloworldworldhello",
+		source:   source,
+		delta: delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "helloworldworldhello",
+			// COPY 5 mode 0 (addr 0), COPY 5 mode 2 (near[0]+6 = 6),
+			// COPY 5 mode HERE (here=21, 21-15 = 6), COPY 5 mode 6
+			// (same[0*256+0] = 0)
+			inst: []byte{21, 53, 37, 117},
+			addr: []byte{0, 6, 15, 0},
+		}),
+	}, {
+		name:     "compound ADD and COPY",
+		expected: "Xhell",
+		source:   source,
+		delta: delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "Xhell",
+			data:      "X",
+			// ADD 1 + COPY 4 mode 0
+			inst: []byte{163},
+			addr: []byte{0},
+		}),
+	}, {
+		name:     "multiple windows with target segment and checksum",
+		expected: "worldworld, world",
+		source:   source,
+		delta: delta(testWindow{
+			indicator:    winSource,
+			segment:      [2]int{5, 6},
+			target:       "world",
+			inst:         []byte{21},
+			addr:         []byte{0},
+			withChecksum: true,
+		}, testWindow{
+			indicator:    winTarget,
+			segment:      [2]int{5, 0},
+			target:       "world, world",
+			data:         ", ",
+			inst:         []byte{21, 3, 21},
+			addr:         []byte{0, 0},
+			withChecksum: true,
+		}),
+	}} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Decode(c.source, c.delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte(c.expected), got) {
+				t.Fatalf("expected %q; got %q", c.expected, got)
+			}
+		})
+	}
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func TestDecodeErrors(t *testing.T) {
+	source := []byte("hello world")
+	valid := delta(testWindow{
+		indicator: winSource,
+		segment:   [2]int{len(source), 0},
+		target:    "hello",
+		inst:      []byte{21},
+		addr:      []byte{0},
+	})
+
+	for _, c := range []struct {
+		name  string
+		delta []byte
+	}{
+		{"invalid magic", append([]byte{0, 0, 0, 0}, valid[4:]...)},
+		{"secondary compression", append(append(append([]byte{}, magic...), hdrDecompress), valid[5:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"source segment out of bounds", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source) + 1, 0},
+			target:    "hello",
+			inst:      []byte{21},
+			addr:      []byte{0},
+		})},
+		{"COPY address out of bounds", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello",
+			inst:      []byte{21},
+			addr:      []byte{20},
+		})},
+		{"wrong target length", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello!",
+			inst:      []byte{21},
+			addr:      []byte{0},
+		})},
+		{"source segment overflowing", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{1, maxInt},
+			target:    "hello",
+			inst:      []byte{21},
+			addr:      []byte{0},
+		})},
+		{"delta encoding length overflowing", append(append(append([]byte{}, magic...), 0, 0), varint(maxInt)...)},
+		{"huge target window", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello",
+			targetLen: maxInt,
+			inst:      []byte{21},
+			addr:      []byte{0},
+		})},
+		{"RUN past target window", delta(testWindow{
+			target: "hello",
+			data:   "h",
+			inst:   append([]byte{0}, varint(1<<40)...),
+		})},
+		{"negative VCD_HERE address", delta(testWindow{
+			indicator: winSource,
+			segment:   [2]int{len(source), 0},
+			target:    "hello",
+			inst:      []byte{37}, // COPY size 5, mode VCD_HERE
+			addr:      varint(len(source) + 100),
+		})},
+		{"checksum mismatch", delta(testWindow{
+			indicator:    winSource,
+			segment:      [2]int{len(source), 0},
+			target:       "hello",
+			inst:         []byte{21},
+			addr:         []byte{0},
+			withChecksum: true,
+			checksum:     1,
+		})},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Decode(source, c.delta)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
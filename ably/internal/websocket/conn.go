@@ -0,0 +1,346 @@
+// Package websocket implements a websocket client, as described in RFC 6455,
+// with support for the permessage-deflate extension described in RFC 7692.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = opText
+	BinaryMessage MessageType = opBinary
+)
+
+// Close status codes, as described in RFC 6455 section 7.4.1.
+const (
+	CloseNormalClosure      = 1000
+	CloseGoingAway          = 1001
+	CloseProtocolError      = 1002
+	CloseUnsupportedData    = 1003
+	CloseNoStatusReceived   = 1005
+	CloseAbnormalClosure    = 1006
+	CloseInvalidPayloadData = 1007
+	ClosePolicyViolation    = 1008
+	CloseMessageTooBig      = 1009
+	CloseMandatoryExtension = 1010
+	CloseInternalServerErr  = 1011
+)
+
+// Opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Frame header bits.
+const (
+	finBit  = 1 << 7
+	rsv1Bit = 1 << 6
+	rsv2Bit = 1 << 5
+	rsv3Bit = 1 << 4
+	maskBit = 1 << 7
+)
+
+const (
+	maxControlPayload = 125
+
+	// maxMessageSize is the maximum size of a received message, once
+	// decompressed.
+	maxMessageSize = 64 << 20
+
+	// compressionThreshold is the minimum size of sent messages that are
+	// compressed, if compression was negotiated. Smaller messages don't
+	// usually compress well enough to be worth it.
+	compressionThreshold = 128
+)
+
+// CloseError is returned by ReadMessage when the server closes the
+// connection with a close frame.
+type CloseError struct {
+	// Code is the close status code. It's CloseNoStatusReceived if the close
+	// frame had no status code.
+	Code int
+	// Reason is the close reason; it may be empty.
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Reason)
+}
+
+// Conn is a websocket connection, as returned by Dial.
+//
+// ReadMessage must only be called from a single goroutine at a time.
+// WriteMessage and Close can be called concurrently with it and with each
+// other.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMtx sync.Mutex
+	deflater deflater // guarded by writeMtx
+
+	compression bool
+	inflater    inflater // only accessed by ReadMessage
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, ext extensions) *Conn {
+	return &Conn{
+		conn:        conn,
+		br:          br,
+		compression: ext.deflate,
+		inflater:    inflater{noContextTakeover: ext.serverNoContextTakeover},
+	}
+}
+
+// ReadMessage reads the next data message from the connection, replying to
+// any ping received meanwhile.
+//
+// If the server closes the connection, a *CloseError is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var compressed bool
+	var msg []byte
+	for {
+		h, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch h.opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, false, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message before the previous one is finished")
+			}
+			typ = MessageType(h.opcode)
+			compressed = h.rsv1
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message")
+			}
+			if h.rsv1 {
+				return 0, nil, c.fail(CloseProtocolError, "RSV1 set on continuation frame")
+			}
+		}
+		if len(msg)+len(payload) > maxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, payload...)
+		if h.fin {
+			break
+		}
+	}
+
+	if compressed {
+		var err error
+		msg, err = c.inflater.inflate(msg)
+		if err != nil {
+			return 0, nil, c.fail(CloseInvalidPayloadData, err.Error())
+		}
+	}
+	if typ == TextMessage && !utf8.Valid(msg) {
+		return 0, nil, c.fail(CloseInvalidPayloadData, "invalid UTF-8 in text message")
+	}
+	return typ, msg, nil
+}
+
+// WriteMessage writes a data message to the connection.
+func (c *Conn) WriteMessage(typ MessageType, p []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	if c.compression && len(p) >= compressionThreshold {
+		compressed, err := c.deflater.deflate(p)
+		if err != nil {
+			return err
+		}
+		return c.lockWriteFrame(byte(typ), true, compressed)
+	}
+	return c.lockWriteFrame(byte(typ), false, p)
+}
+
+// SetReadDeadline sets the deadline for ReadMessage, as in net.Conn.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for WriteMessage, as in net.Conn.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close sends a close frame with CloseNormalClosure and closes the underlying
+// connection, without waiting for the server's close frame.
+func (c *Conn) Close() error {
+	// The connection is closed anyway, so a failure to send the close frame
+	// doesn't matter.
+	_ = c.writeFrame(opClose, false, closePayload(CloseNormalClosure, ""))
+	return c.conn.Close()
+}
+
+// handleClose replies to a close frame from the server and closes the
+// connection.
+func (c *Conn) handleClose(payload []byte) error {
+	err := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close frame payload")
+	case len(payload) >= 2:
+		err.Code = int(binary.BigEndian.Uint16(payload))
+		err.Reason = string(payload[2:])
+		if !utf8.ValidString(err.Reason) {
+			return c.fail(CloseProtocolError, "invalid UTF-8 in close reason")
+		}
+	}
+	echo := []byte{}
+	if err.Code != CloseNoStatusReceived {
+		echo = closePayload(err.Code, "")
+	}
+	_ = c.writeFrame(opClose, false, echo)
+	c.conn.Close()
+	return err
+}
+
+// fail closes the connection with the given close code after a protocol
+// violation by the server, as described in RFC 6455 section 7.1.7.
+func (c *Conn) fail(code int, reason string) error {
+	_ = c.writeFrame(opClose, false, closePayload(code, reason))
+	c.conn.Close()
+	return errors.New("websocket: " + reason)
+}
+
+func closePayload(code int, reason string) []byte {
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	p := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	return append(p, reason...)
+}
+
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	opcode byte
+}
+
+func (c *Conn) readFrame() (frameHeader, []byte, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+		return h, nil, err
+	}
+	h.fin = b[0]&finBit != 0
+	h.rsv1 = b[0]&rsv1Bit != 0
+	h.opcode = b[0] & 0xf
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 || h.rsv1 && !c.compression {
+		return h, nil, c.fail(CloseProtocolError, "unexpected RSV bits")
+	}
+	if b[1]&maskBit != 0 {
+		return h, nil, c.fail(CloseProtocolError, "masked frame from server")
+	}
+
+	length := uint64(b[1] &^ maskBit)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+			return h, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, b[:8]); err != nil {
+			return h, nil, err
+		}
+		length = binary.BigEndian.Uint64(b[:8])
+	}
+
+	switch h.opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		if !h.fin || h.rsv1 || length > maxControlPayload {
+			return h, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	default:
+		return h, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", h.opcode))
+	}
+	if length > maxMessageSize {
+		return h, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+func (c *Conn) writeFrame(opcode byte, rsv1 bool, payload []byte) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	return c.lockWriteFrame(opcode, rsv1, payload)
+}
+
+// lockWriteFrame writes a single, final frame, masked as every frame sent by
+// a client must be.
+func (c *Conn) lockWriteFrame(opcode byte, rsv1 bool, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	b0 := finBit | opcode
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	frame = append(frame, b0)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, b[:]...)
+	}
+
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+	frame = append(frame, key[:]...)
+	start := len(frame)
+	frame = append(frame, payload...)
+	for i := range frame[start:] {
+		frame[start+i] ^= key[i%4]
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// windowSize is the size of the DEFLATE sliding window, which is how far back
+// compressed messages can reference previous messages when the server uses
+// context takeover.
+const windowSize = 32 << 10
+
+// deflateTail is the end of the DEFLATE block that's removed from every
+// compressed message (RFC 7692 section 7.2.1), followed by an empty final
+// block so that decompressing a message ends with io.EOF.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// deflater compresses messages, without context takeover: every message is
+// compressed independently.
+type deflater struct {
+	buf bytes.Buffer
+	w   *flate.Writer
+}
+
+func (d *deflater) deflate(p []byte) ([]byte, error) {
+	d.buf.Reset()
+	if d.w == nil {
+		w, err := flate.NewWriter(&d.buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		d.w = w
+	} else {
+		d.w.Reset(&d.buf)
+	}
+	if _, err := d.w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := d.w.Flush(); err != nil {
+		return nil, err
+	}
+	b := d.buf.Bytes()
+	b = bytes.TrimSuffix(b, deflateTail[:4])
+	return append([]byte(nil), b...), nil
+}
+
+// inflater decompresses messages. Unless noContextTakeover is set, messages
+// may reference the previous messages' data, so the last windowSize bytes
+// decompressed are kept as a dictionary for the next message.
+type inflater struct {
+	noContextTakeover bool
+
+	r    io.ReadCloser
+	dict []byte
+}
+
+func (i *inflater) inflate(p []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateTail))
+	if i.r == nil {
+		i.r = flate.NewReaderDict(src, i.dict)
+	} else if err := i.r.(flate.Resetter).Reset(src, i.dict); err != nil {
+		return nil, err
+	}
+	out, err := ioutil.ReadAll(io.LimitReader(i.r, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxMessageSize {
+		return nil, errors.New("decompressed message too big")
+	}
+	if !i.noContextTakeover {
+		dict := append(i.dict, out...)
+		if len(dict) > windowSize {
+			dict = append([]byte(nil), dict[len(dict)-windowSize:]...)
+		}
+		i.dict = dict
+	}
+	return out, nil
+}
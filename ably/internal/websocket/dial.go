@@ -0,0 +1,345 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// acceptGUID is concatenated to the handshake key to compute the accept key,
+// as described in RFC 6455 section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DialOptions configures Dial.
+type DialOptions struct {
+	// Header holds additional headers for the opening handshake request.
+	Header http.Header
+
+	// TLSConfig is used for wss URLs and HTTPS proxies. If nil, the default
+	// configuration is used.
+	TLSConfig *tls.Config
+
+	// Proxy returns the URL of the HTTP proxy to tunnel the connection
+	// through with the CONNECT method, given the opening handshake request,
+	// whose URL has either the http or the https scheme. If it's nil or
+	// returns a nil URL, the connection isn't proxied.
+	//
+	// http.ProxyFromEnvironment can be used to honour the HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Compression makes the client offer the permessage-deflate extension.
+	Compression bool
+}
+
+// HandshakeError is returned by Dial when the server doesn't accept the
+// opening handshake.
+type HandshakeError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body is the beginning of the response body.
+	Body []byte
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: bad handshake status " + e.Status
+}
+
+// ProxyError is returned by Dial when the proxy doesn't accept the CONNECT
+// request.
+type ProxyError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *ProxyError) Error() string {
+	return "websocket: proxy CONNECT failed with status " + e.Status
+}
+
+// Dial opens a websocket connection to the given ws or wss URL.
+//
+// If the context is canceled or its deadline passes before the opening
+// handshake finishes, Dial fails with the context's error.
+func Dial(ctx context.Context, rawURL string, opts DialOptions) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	httpURL := *u
+	switch u.Scheme {
+	case "ws":
+		httpURL.Scheme = "http"
+	case "wss":
+		httpURL.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("websocket: unsupported URL scheme %q", u.Scheme)
+	}
+	httpURL.Fragment = ""
+
+	req, err := http.NewRequest(http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	key, err := handshakeKey()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if opts.Compression {
+		req.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_no_context_takeover")
+	}
+
+	var proxyURL *url.URL
+	if opts.Proxy != nil {
+		proxyURL, err = opts.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addr := hostPort(&httpURL)
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialNet(ctx, hostPort(proxyURL))
+	} else {
+		conn, err = dialNet(ctx, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := handshake(ctx, conn, req, key, addr, proxyURL, opts)
+	if err != nil {
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+func dialNet(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// handshake sets up the proxy tunnel and TLS, if needed, and performs the
+// opening handshake over conn. The context's deadline and cancellation apply
+// to conn until handshake returns.
+func handshake(ctx context.Context, conn net.Conn, req *http.Request, key, addr string, proxyURL *url.URL, opts DialOptions) (*Conn, error) {
+	raw := conn
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// Unblock any pending I/O.
+			raw.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+		raw.SetDeadline(time.Time{})
+	}()
+
+	if proxyURL != nil {
+		var err error
+		if proxyURL.Scheme == "https" {
+			conn, err = clientTLS(conn, proxyURL.Hostname(), opts.TLSConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := connectProxy(conn, addr, proxyURL); err != nil {
+			return nil, err
+		}
+	}
+	if req.URL.Scheme == "https" {
+		var err error
+		conn, err = clientTLS(conn, req.URL.Hostname(), opts.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, &HandshakeError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       body,
+		}
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		!headerContainsToken(resp.Header, "Connection", "upgrade") {
+		return nil, errors.New("websocket: server didn't upgrade the connection")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errors.New("websocket: invalid Sec-WebSocket-Accept header")
+	}
+	ext, err := parseExtensions(resp.Header, opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, br, ext), nil
+}
+
+func clientTLS(conn net.Conn, serverName string, config *tls.Config) (net.Conn, error) {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// connectProxy opens a tunnel to addr through the proxy at the other end of
+// conn.
+func connectProxy(conn net.Conn, addr string, proxyURL *url.URL) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &ProxyError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if br.Buffered() > 0 {
+		return errors.New("websocket: unexpected data from proxy after CONNECT")
+	}
+	return nil
+}
+
+type extensions struct {
+	deflate                 bool
+	serverNoContextTakeover bool
+}
+
+// parseExtensions parses the extensions accepted by the server in the
+// opening handshake response.
+func parseExtensions(h http.Header, offeredDeflate bool) (extensions, error) {
+	var ext extensions
+	for _, header := range h.Values("Sec-WebSocket-Extensions") {
+		for _, e := range strings.Split(header, ",") {
+			params := strings.Split(e, ";")
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+			if name != "permessage-deflate" || !offeredDeflate || ext.deflate {
+				return ext, fmt.Errorf("websocket: unexpected extension %q", name)
+			}
+			ext.deflate = true
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				switch {
+				case p == "server_no_context_takeover":
+					ext.serverNoContextTakeover = true
+				case p == "client_no_context_takeover",
+					strings.HasPrefix(p, "server_max_window_bits"):
+					// Compressed messages are sent without context takeover
+					// anyway, and a smaller server window needs nothing
+					// special to decompress.
+				default:
+					return ext, fmt.Errorf("websocket: unexpected permessage-deflate parameter %q", p)
+				}
+			}
+		}
+	}
+	return ext, nil
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handshakeKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		return net.JoinHostPort(u.Hostname(), "443")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
@@ -0,0 +1,373 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serverConn is the server side of a websocket connection, for tests.
+type serverConn struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func (s serverConn) writeFrame(b0 byte, payload []byte) {
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		frame = append(append(frame, 127), b[:]...)
+	}
+	if _, err := s.conn.Write(append(frame, payload...)); err != nil {
+		s.t.Errorf("writing frame: %v", err)
+	}
+}
+
+func (s serverConn) readFrame() (b0 byte, payload []byte) {
+	var h [2]byte
+	if _, err := io.ReadFull(s.br, h[:]); err != nil {
+		s.t.Errorf("reading frame: %v", err)
+		return 0, nil
+	}
+	if h[1]&maskBit == 0 {
+		s.t.Errorf("expected masked frame from client")
+	}
+	n := uint64(h[1] &^ maskBit)
+	switch n {
+	case 126:
+		var b [2]byte
+		io.ReadFull(s.br, b[:])
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(s.br, b[:])
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	var key [4]byte
+	io.ReadFull(s.br, key[:])
+	payload = make([]byte, n)
+	io.ReadFull(s.br, payload)
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+	return h[0], payload
+}
+
+// newServer starts a websocket server that runs handle for each connection.
+// If extensions isn't empty, it's sent as the accepted extensions.
+func newServer(t *testing.T, extensions string, handle func(serverConn)) *httptest.Server {
+	return httptest.NewServer(websocketHandler(t, extensions, handle))
+}
+
+func websocketHandler(t *testing.T, extensions string, handle func(serverConn)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("unexpected Sec-WebSocket-Version %q", r.Header.Get("Sec-WebSocket-Version"))
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n"
+		if extensions != "" {
+			resp += "Sec-WebSocket-Extensions: " + extensions + "\r\n"
+		}
+		if _, err := io.WriteString(conn, resp+"\r\n"); err != nil {
+			t.Error(err)
+			return
+		}
+		handle(serverConn{t: t, conn: conn, br: brw.Reader})
+	})
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, rawURL string, opts DialOptions) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, rawURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func expectMessage(t *testing.T, c *Conn, typ MessageType, data string) {
+	t.Helper()
+	gotTyp, got, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotTyp != typ || string(got) != data {
+		t.Fatalf("expected message %d %q; got %d %q", typ, data, gotTyp, got)
+	}
+}
+
+func TestConn_Messages(t *testing.T) {
+	pong := make(chan string, 1)
+	srv := newServer(t, "", func(s serverConn) {
+		s.writeFrame(finBit|opPing, []byte("ping"))
+		s.writeFrame(finBit|opText, []byte("after ping"))
+		b0, payload := s.readFrame()
+		if b0 != finBit|opPong {
+			t.Errorf("expected pong; got frame %x", b0)
+		}
+		pong <- string(payload)
+
+		// Echo two messages.
+		for i := 0; i < 2; i++ {
+			b0, payload := s.readFrame()
+			s.writeFrame(b0, payload)
+		}
+
+		// A fragmented message, with a ping in between.
+		s.writeFrame(opText, []byte("hello "))
+		s.writeFrame(finBit|opPing, nil)
+		s.writeFrame(finBit|opContinuation, []byte("world"))
+		s.readFrame() // pong
+
+		s.writeFrame(finBit|opBinary, bytes.Repeat([]byte{1}, 70000))
+		s.readFrame() // wait for the client to close
+	})
+	defer srv.Close()
+
+	c := dial(t, wsURL(srv), DialOptions{})
+	defer c.Close()
+
+	expectMessage(t, c, TextMessage, "after ping")
+	select {
+	case p := <-pong:
+		if p != "ping" {
+			t.Fatalf("expected pong with ping's payload; got %q", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pong")
+	}
+
+	if err := c.WriteMessage(TextMessage, []byte("text")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteMessage(BinaryMessage, bytes.Repeat([]byte{0}, 300)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, TextMessage, "text")
+	expectMessage(t, c, BinaryMessage, string(bytes.Repeat([]byte{0}, 300)))
+	expectMessage(t, c, TextMessage, "hello world")
+	expectMessage(t, c, BinaryMessage, string(bytes.Repeat([]byte{1}, 70000)))
+}
+
+func TestConn_CloseFromServer(t *testing.T) {
+	echo := make(chan []byte, 1)
+	srv := newServer(t, "", func(s serverConn) {
+		s.writeFrame(finBit|opClose, append([]byte{0x0f, 0xa0}, "bye"...)) // 4000
+		_, payload := s.readFrame()
+		echo <- payload
+	})
+	defer srv.Close()
+
+	c := dial(t, wsURL(srv), DialOptions{})
+	defer c.Close()
+
+	_, _, err := c.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("expected *CloseError; got %v", err)
+	}
+	if closeErr.Code != 4000 || closeErr.Reason != "bye" {
+		t.Fatalf("expected close code 4000 and reason %q; got %+v", "bye", closeErr)
+	}
+	if p := <-echo; !bytes.Equal(p, []byte{0x0f, 0xa0}) {
+		t.Fatalf("expected the close code to be echoed; got %x", p)
+	}
+}
+
+func TestConn_ProtocolError(t *testing.T) {
+	closed := make(chan []byte, 1)
+	srv := newServer(t, "", func(s serverConn) {
+		s.writeFrame(finBit|opContinuation, []byte("nothing to continue"))
+		_, payload := s.readFrame()
+		closed <- payload
+	})
+	defer srv.Close()
+
+	c := dial(t, wsURL(srv), DialOptions{})
+	defer c.Close()
+
+	if _, _, err := c.ReadMessage(); err == nil {
+		t.Fatal("expected error")
+	}
+	if p := <-closed; len(p) < 2 || binary.BigEndian.Uint16(p) != CloseProtocolError {
+		t.Fatalf("expected close frame with code %d; got %x", CloseProtocolError, p)
+	}
+}
+
+func TestConn_Compression(t *testing.T) {
+	messages := []string{
+		strings.Repeat("compressed message ", 10),
+		strings.Repeat("compressed message ", 20), // references the previous message
+	}
+	received := make(chan string, 1)
+	srv := newServer(t, "permessage-deflate; client_no_context_takeover", func(s serverConn) {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		for _, m := range messages {
+			buf.Reset()
+			w.Write([]byte(m))
+			w.Flush()
+			s.writeFrame(finBit|rsv1Bit|opText, bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]))
+		}
+		s.writeFrame(finBit|opText, []byte("uncompressed"))
+
+		b0, payload := s.readFrame()
+		if b0&rsv1Bit == 0 {
+			t.Errorf("expected compressed message")
+		}
+		r := flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail)))
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- string(data)
+		s.readFrame() // wait for the client to close
+	})
+	defer srv.Close()
+
+	c := dial(t, wsURL(srv), DialOptions{Compression: true})
+	defer c.Close()
+
+	for _, m := range messages {
+		expectMessage(t, c, TextMessage, m)
+	}
+	expectMessage(t, c, TextMessage, "uncompressed")
+
+	sent := strings.Repeat("client message ", 20)
+	if err := c.WriteMessage(TextMessage, []byte(sent)); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != sent {
+		t.Fatalf("expected server to receive %q; got %q", sent, got)
+	}
+}
+
+func TestDial_HandshakeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no websockets here", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := Dial(context.Background(), wsURL(srv), DialOptions{})
+	var handshakeErr *HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("expected *HandshakeError; got %v", err)
+	}
+	if handshakeErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status %d; got %d", http.StatusForbidden, handshakeErr.StatusCode)
+	}
+	if !strings.Contains(string(handshakeErr.Body), "no websockets here") {
+		t.Fatalf("expected response body in error; got %q", handshakeErr.Body)
+	}
+}
+
+func TestDial_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(websocketHandler(t, "", func(s serverConn) {
+		b0, payload := s.readFrame()
+		s.writeFrame(b0, payload)
+		s.readFrame()
+	}))
+	defer srv.Close()
+	u := "wss" + strings.TrimPrefix(srv.URL, "https")
+
+	if _, err := Dial(context.Background(), u, DialOptions{}); err == nil {
+		t.Fatal("expected error with a certificate from an unknown authority")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	c := dial(t, u, DialOptions{TLSConfig: &tls.Config{RootCAs: roots}})
+	defer c.Close()
+	if err := c.WriteMessage(TextMessage, []byte("secure")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, TextMessage, "secure")
+}
+
+func TestDial_Proxy(t *testing.T) {
+	srv := newServer(t, "", func(s serverConn) {
+		b0, payload := s.readFrame()
+		s.writeFrame(b0, payload)
+		s.readFrame()
+	})
+	defer srv.Close()
+
+	connects := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects <- r
+		if r.Method != http.MethodConnect {
+			http.Error(w, "expected CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "secret")
+	c := dial(t, wsURL(srv), DialOptions{Proxy: http.ProxyURL(proxyURL)})
+	defer c.Close()
+
+	r := <-connects
+	if expected, got := srv.Listener.Addr().String(), r.Host; expected != got {
+		t.Fatalf("expected CONNECT to %q; got %q", expected, got)
+	}
+	if expected, got := "Basic dXNlcjpzZWNyZXQ=", r.Header.Get("Proxy-Authorization"); expected != got {
+		t.Fatalf("expected Proxy-Authorization %q; got %q", expected, got)
+	}
+
+	if err := c.WriteMessage(TextMessage, []byte("proxied")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, TextMessage, "proxied")
+}
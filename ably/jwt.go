@@ -0,0 +1,130 @@
+package ably
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// jwtHeader is the header of an Ably JWT.
+type jwtHeader struct {
+	Type      string `json:"typ,omitempty"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// jwtClaims are the claims of an Ably JWT that the library knows about. Times
+// are in seconds since the Unix epoch.
+type jwtClaims struct {
+	IssuedAt  int64 `json:"iat,omitempty"`
+	ExpiresAt int64 `json:"exp,omitempty"`
+	// Capability is the JSON-encoded capability, as in TokenParams.
+	Capability string `json:"x-ably-capability,omitempty"`
+	ClientID   string `json:"x-ably-clientId,omitempty"`
+}
+
+// CreateJWT creates an Ably JWT for the given params, signed with the key
+// secret using HS256. Clients can authenticate with it as they do with a
+// token; e.g. an AuthCallback can return it as a TokenString.
+//
+// As with CreateTokenRequest, params that aren't set are taken from the
+// client options or set to their defaults, and the key can be set with
+// opts.
+func (a *Auth) CreateJWT(params *TokenParams, opts ...AuthOption) (string, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	o := &a.opts().authOptions
+	if opts != nil {
+		o = applyAuthOptionsWithDefaults(opts...)
+	}
+	keySecret := o.KeySecret()
+	req := &TokenRequest{KeyName: o.KeyName()}
+	if params != nil {
+		req.TokenParams = *params
+	}
+	if err := a.setDefaults(o, req); err != nil {
+		return "", err
+	}
+	switch {
+	case o.Key == "":
+		return "", newError(ErrInvalidCredentials, errMissingKey)
+	case req.KeyName == "" || keySecret == "":
+		return "", newError(ErrIncompatibleCredentials, errInvalidKey)
+	}
+	issuedAt := req.Timestamp / 1000
+	claims := jwtClaims{
+		IssuedAt:   issuedAt,
+		ExpiresAt:  issuedAt + req.TTL/1000,
+		Capability: req.Capability,
+		ClientID:   req.ClientID,
+	}
+	header := jwtHeader{Type: "JWT", Algorithm: "HS256", KeyID: req.KeyName}
+	token, err := signJWT(header, claims, []byte(keySecret))
+	if err != nil {
+		return "", newError(40000, err)
+	}
+	return token, nil
+}
+
+func signJWT(header jwtHeader, claims jwtClaims, secret []byte) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// parseJWT parses the claims of token, if it's a JWT. The signature isn't
+// verified; only Ably can do that.
+func parseJWT(token string) (jwtClaims, bool) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, false
+	}
+	var header jwtHeader
+	if !decodeJWTPart(parts[0], &header) || header.Algorithm == "" {
+		return claims, false
+	}
+	var raw struct {
+		IssuedAt  float64 `json:"iat"`
+		ExpiresAt float64 `json:"exp"`
+		// Capability is usually a string holding the JSON-encoded
+		// capability, but may be the capability object itself.
+		Capability json.RawMessage `json:"x-ably-capability"`
+		ClientID   string          `json:"x-ably-clientId"`
+	}
+	if !decodeJWTPart(parts[1], &raw) {
+		return claims, false
+	}
+	claims.IssuedAt = int64(raw.IssuedAt)
+	claims.ExpiresAt = int64(raw.ExpiresAt)
+	claims.ClientID = raw.ClientID
+	if len(raw.Capability) > 0 && raw.Capability[0] == '"' {
+		if err := json.Unmarshal(raw.Capability, &claims.Capability); err != nil {
+			return claims, false
+		}
+	} else if len(raw.Capability) > 0 && !bytes.Equal(raw.Capability, []byte("null")) {
+		claims.Capability = string(raw.Capability)
+	}
+	return claims, true
+}
+
+func decodeJWTPart(part string, v interface{}) bool {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, v) == nil
+}
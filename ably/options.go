@@ -2,8 +2,11 @@ package ably
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
@@ -26,6 +29,11 @@ const (
 	realtimeHost = "realtime.ably.io"
 	Port         = 80
 	TLSPort      = 443
+
+	// internetCheckURL is requested before trying realtime fallback hosts to
+	// tell a down primary host from a down internet connection (RTN17c).
+	internetCheckURL = "https://internet-up.ably-realtime.com/is-the-internet-up.txt"
+	internetCheckOK  = "yes"
 )
 
 var defaultOptions = clientOptions{
@@ -42,6 +50,7 @@ var defaultOptions = clientOptions{
 	HTTPOpenTimeout:          4 * time.Second,  //TO3l3
 	ChannelRetryTimeout:      15 * time.Second, // TO3l7
 	FallbackRetryTimeout:     10 * time.Minute,
+	TokenRenewalMargin:       30 * time.Second,
 	IdempotentRESTPublishing: false,
 	Port:                     Port,
 	TLSPort:                  TLSPort,
@@ -242,11 +251,43 @@ type clientOptions struct {
 	// If Dial is nil, the default websocket connection is used.
 	Dial func(protocol string, u *url.URL, timeout time.Duration) (conn, error)
 
+	// Transport specifies the transport for realtime connections. It's
+	// ignored if Dial is set.
+	//
+	// If Transport is nil, the default websocket transport is used.
+	Transport Transport
+
+	// TokenRenewalMargin is how long before a token expires it's renewed, if
+	// it can be renewed. Tokens whose whole lifetime is shorter than twice the
+	// margin are renewed halfway through it instead.
+	TokenRenewalMargin time.Duration
+
+	// CometMode sets when the Comet transport is used instead of websockets.
+	CometMode CometMode
+
 	// HTTPClient specifies the client used for HTTP communication by REST.
 	//
 	// If HTTPClient is nil, a client configured with default settings is used.
 	HTTPClient *http.Client
 
+	// Proxy returns the URL of the proxy for a request, as in
+	// http.Transport. It's used by websocket connections and, if HTTPClient
+	// is nil, by REST requests.
+	//
+	// If Proxy is nil, the proxy is taken from the HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// TLSConfig is the TLS configuration for REST requests, if HTTPClient is
+	// nil, and for realtime connections.
+	//
+	// If TLSConfig is nil, the default configuration is used.
+	TLSConfig *tls.Config
+
+	// httpTransport is the transport for the default HTTP client, when
+	// http.DefaultTransport doesn't fit the options.
+	httpTransport http.RoundTripper
+
 	//When provided this will be used on every request.
 	Trace *httptrace.ClientTrace
 
@@ -337,7 +378,13 @@ func (opts *clientOptions) restURL() (restUrl string) {
 }
 
 func (opts *clientOptions) realtimeURL() (realtimeUrl string) {
-	baseUrl := opts.getRealtimeHost()
+	return opts.realtimeURLForHost(opts.getRealtimeHost())
+}
+
+// realtimeURLForHost returns the realtime URL for the given host, which is
+// either the primary realtime host or one of the fallback hosts.
+func (opts *clientOptions) realtimeURLForHost(host string) (realtimeUrl string) {
+	baseUrl := host
 	_, _, err := net.SplitHostPort(baseUrl)
 	if err != nil { // set port if not set in baseUrl
 		port, _ := opts.activePort()
@@ -401,6 +448,14 @@ func (opts *clientOptions) realtimeRequestTimeout() time.Duration {
 	}
 	return defaultOptions.RealtimeRequestTimeout
 }
+
+func (opts *clientOptions) tokenRenewalMargin() time.Duration {
+	if opts.TokenRenewalMargin != 0 {
+		return opts.TokenRenewalMargin
+	}
+	return defaultOptions.TokenRenewalMargin
+}
+
 func (opts *clientOptions) connectionStateTTL() time.Duration {
 	if opts.ConnectionStateTTL != 0 {
 		return opts.ConnectionStateTTL
@@ -434,8 +489,34 @@ func (opts *clientOptions) httpclient() *http.Client {
 		return opts.HTTPClient
 	}
 	return &http.Client{
-		Timeout: opts.HTTPRequestTimeout,
+		Timeout:   opts.HTTPRequestTimeout,
+		Transport: opts.httpTransport,
+	}
+}
+
+func (opts *clientOptions) proxy() func(*http.Request) (*url.URL, error) {
+	if opts.Proxy != nil {
+		return opts.Proxy
+	}
+	return http.ProxyFromEnvironment
+}
+
+// hasActiveInternetConnection checks whether the internet is reachable by
+// requesting a well-known Ably endpoint (RTN17c).
+func (opts *clientOptions) hasActiveInternetConnection() bool {
+	resp, err := opts.httpclient().Get(internetCheckURL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return false
 	}
+	return strings.TrimSpace(string(body)) == internetCheckOK
 }
 
 func (opts *clientOptions) protocol() string {
@@ -512,6 +593,9 @@ type Tokener interface {
 }
 
 // A TokenString is the string representation of an authentication token.
+//
+// It may be an Ably JWT, in which case the token's details, like its expiry
+// time and client ID, are taken from its claims.
 type TokenString string
 
 func (TokenString) IsTokener() {}
@@ -811,6 +895,59 @@ func WithDial(dial func(protocol string, u *url.URL, timeout time.Duration) (con
 	}
 }
 
+// WithTLSConfig sets the TLS configuration, e.g. with a custom root CA pool,
+// client certificates or a minimum TLS version, for both REST requests and
+// realtime connections.
+//
+// If an HTTP client is set with WithHTTPClient, REST requests and the Comet
+// transport use that client's configuration instead.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(os *clientOptions) {
+		os.TLSConfig = config
+	}
+}
+
+// WithProxy sets the function that returns the URL of the proxy for a
+// request, both for REST requests and realtime websocket connections, which
+// are tunneled through the proxy with the CONNECT method. http.ProxyURL
+// returns such a function for a fixed proxy URL.
+//
+// By default, the proxy is taken from the HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY environment variables.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ClientOption {
+	return func(os *clientOptions) {
+		os.Proxy = proxy
+	}
+}
+
+// WithTransport sets the transport that Realtime clients dial connections to
+// Ably through, instead of the default websocket transport.
+func WithTransport(t Transport) ClientOption {
+	return func(os *clientOptions) {
+		os.Transport = t
+	}
+}
+
+// WithTokenRenewalMargin sets how long before a token expires the client
+// renews it, given that it has the means to do so, i.e. a key, an AuthURL or
+// an AuthCallback. Realtime clients send the renewed token to Ably without
+// interrupting the connection. The default margin is 30 seconds.
+func WithTokenRenewalMargin(d time.Duration) ClientOption {
+	return func(os *clientOptions) {
+		os.TokenRenewalMargin = d
+	}
+}
+
+// WithCometMode sets when Realtime clients connect through the Comet transport,
+// which long polls over HTTP with the client's HTTPClient, instead of
+// websockets. By default, it's only used after websocket connections keep
+// failing.
+func WithCometMode(mode CometMode) ClientOption {
+	return func(os *clientOptions) {
+		os.CometMode = mode
+	}
+}
+
 func applyOptionsWithDefaults(opts ...ClientOption) *clientOptions {
 	to := defaultOptions
 	// No need to set hosts by default
@@ -833,6 +970,15 @@ func applyOptionsWithDefaults(opts ...ClientOption) *clientOptions {
 	}
 	to.LogHandler = filteredLogger{Logger: to.LogHandler, Level: to.LogLevel}
 
+	if to.Proxy != nil || to.TLSConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if to.Proxy != nil {
+			t.Proxy = to.Proxy
+		}
+		t.TLSClientConfig = to.TLSConfig
+		to.httpTransport = t
+	}
+
 	return &to
 }
 
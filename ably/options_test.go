@@ -1,11 +1,20 @@
 package ably_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/ably/ably-go/ably"
+	"github.com/ably/ably-go/ablytest"
 )
 
 func TestDefaultFallbacks_RSC15h(t *testing.T) {
@@ -313,3 +322,79 @@ func TestPaginateParams(t *testing.T) {
 		}
 	})
 }
+
+func TestClientOptions_TLSConfig(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/time" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "[1600000000000]")
+			return
+		}
+		conn := acceptWebsocket(t, w, r)
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		writeWebsocketText(conn, `{"action":4,"connectionId":"connection-id","connectionDetails":{}}`)
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	for _, c := range []struct {
+		name      string
+		tlsConfig *tls.Config
+		expectErr bool
+	}{
+		{"without custom root CA", nil, true},
+		{"with custom root CA", &tls.Config{RootCAs: roots}, false},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			opts := []ably.ClientOption{
+				ably.WithToken("fake:token"),
+				ably.WithRESTHost(host),
+				ably.WithRealtimeHost(host),
+				ably.WithTLSPort(port),
+				ably.WithUseBinaryProtocol(false),
+				ably.WithTLSConfig(c.tlsConfig),
+			}
+
+			rest, err := ably.NewREST(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rest.Time(context.Background())
+			if c.expectErr != (err != nil) {
+				t.Fatalf("expected error: %v; got %v", c.expectErr, err)
+			}
+
+			realtime, err := ably.NewRealtime(append(opts, ably.WithAutoConnect(false))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer realtime.Close()
+			changes := make(ably.ConnStateChanges, 3)
+			off := realtime.Connection.OnAll(changes.Receive)
+			defer off()
+			realtime.Connect()
+
+			var change ably.ConnectionStateChange
+			ablytest.Instantly.Recv(t, &change, changes, t.Fatalf) // CONNECTING
+			ablytest.Soon.Recv(t, &change, changes, t.Fatalf)
+			expected := ably.ConnectionStateConnected
+			if c.expectErr {
+				expected = ably.ConnectionStateDisconnected
+			}
+			if expected != change.Current {
+				t.Fatalf("expected %v; got %v (reason: %v)", expected, change.Current, change.Reason)
+			}
+		})
+	}
+}
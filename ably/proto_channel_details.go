@@ -0,0 +1,40 @@
+package ably
+
+// ChannelDetails holds the details of a channel, as given by
+// RESTChannel.Status.
+type ChannelDetails struct {
+	ChannelID string        `json:"channelId" codec:"channelId"`
+	Status    ChannelStatus `json:"status" codec:"status"`
+}
+
+// ChannelStatus holds whether a channel is active and its occupancy.
+type ChannelStatus struct {
+	// IsActive tells whether the channel is attached by any client or has
+	// been published on recently.
+	IsActive  bool             `json:"isActive" codec:"isActive"`
+	Occupancy ChannelOccupancy `json:"occupancy" codec:"occupancy"`
+}
+
+// ChannelOccupancy holds the metrics of a channel's occupancy.
+type ChannelOccupancy struct {
+	Metrics ChannelMetrics `json:"metrics" codec:"metrics"`
+}
+
+// ChannelMetrics holds the number of connections attached to a channel, by
+// what they're attached for.
+type ChannelMetrics struct {
+	// Connections is the number of connections attached to the channel.
+	Connections int `json:"connections" codec:"connections"`
+	// Publishers is the number of connections attached that can publish.
+	Publishers int `json:"publishers" codec:"publishers"`
+	// Subscribers is the number of connections attached that can subscribe.
+	Subscribers int `json:"subscribers" codec:"subscribers"`
+	// PresenceConnections is the number of connections attached that can
+	// enter the presence set.
+	PresenceConnections int `json:"presenceConnections" codec:"presenceConnections"`
+	// PresenceMembers is the number of members in the presence set.
+	PresenceMembers int `json:"presenceMembers" codec:"presenceMembers"`
+	// PresenceSubscribers is the number of connections attached that can
+	// subscribe to presence messages.
+	PresenceSubscribers int `json:"presenceSubscribers" codec:"presenceSubscribers"`
+}
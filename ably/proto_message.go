@@ -5,9 +5,12 @@ import (
 	"crypto/aes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/ably/ably-go/ably/internal/vcdiff"
 )
 
 // encodings
@@ -16,6 +19,7 @@ const (
 	encJSON   = "json"
 	encBase64 = "base64"
 	encCipher = "cipher"
+	encVCDiff = "vcdiff"
 )
 
 // Message is what Ably channels send and receive.
@@ -97,63 +101,150 @@ func (m Message) withEncodedData(cipher channelCipher) (Message, error) {
 
 func (m Message) withDecodedData(cipher channelCipher) (Message, error) {
 	// TODO: Unexport once proto gets merged into package ably.
+	return m.withDeltaDecodedData(cipher, nil)
+}
 
+// deltaBase is the payload of the last message received on a channel, which
+// is the base for decoding the next message if it's a vcdiff delta (RTL19).
+type deltaBase struct {
+	id      string
+	payload []byte
+}
+
+func (b *deltaBase) set(id string, payload interface{}) {
+	b.id = id
+	switch v := payload.(type) {
+	case []byte:
+		b.payload = v
+	case string:
+		b.payload = []byte(v) // RTL19a
+	default:
+		b.payload = nil
+	}
+}
+
+// deltaDecodeError is returned when a vcdiff delta message can't be decoded,
+// which means the channel needs to recover from the last message it
+// processed (RTL18).
+type deltaDecodeError struct {
+	err error
+}
+
+func (e *deltaDecodeError) Error() string {
+	return "decoding vcdiff delta: " + e.err.Error()
+}
+
+func (e *deltaDecodeError) Unwrap() error {
+	return e.err
+}
+
+// deltaFrom returns the ID of the message that the message is a delta of,
+// from its extras (TM2i).
+func (m Message) deltaFrom() string {
+	var from interface{}
+	switch delta := m.Extras["delta"].(type) {
+	case map[string]interface{}:
+		from = delta["from"]
+	case map[interface{}]interface{}:
+		from = delta["from"]
+	}
+	s, _ := from.(string)
+	return s
+}
+
+// withDeltaDecodedData is like withDecodedData, but also decodes vcdiff
+// deltas from the given base. The base is then updated with the message's
+// payload, for the next delta. If base is nil, deltas can't be decoded.
+func (m Message) withDeltaDecodedData(cipher channelCipher, base *deltaBase) (Message, error) {
+	decoded, payload, err := m.decodeData(cipher, base)
+	var deltaErr *deltaDecodeError
+	if base != nil && !errors.As(err, &deltaErr) {
+		base.set(decoded.ID, payload)
+	}
+	return decoded, err
+}
+
+// decodeData decodes the message's data, returning it alongside its payload
+// once decoded from its transport-level base64 and vcdiff encodings (RTL19b).
+func (m Message) decodeData(cipher channelCipher, base *deltaBase) (Message, interface{}, error) {
+	payload := m.Data
 	// strings.Split on empty string returns []string{""}
 	if m.Data == nil || m.Encoding == "" {
-		return m, nil
+		return m, payload, nil
 	}
 	encodings := strings.Split(m.Encoding, "/")
-	for len(encodings) > 0 {
+	for first := true; len(encodings) > 0; first = false {
 		encoding := encodings[len(encodings)-1]
 		encodings = encodings[:len(encodings)-1]
 		switch encoding {
 		case encBase64:
 			d, err := coerceString(m.Data)
 			if err != nil {
-				return m, err
+				return m, payload, err
 			}
 			data, err := base64.StdEncoding.DecodeString(d)
 			if err != nil {
-				return m, err
+				return m, payload, err
+			}
+			m.Data = data
+			if first {
+				payload = data
+			}
+		case encVCDiff:
+			if base == nil {
+				return m, payload, &deltaDecodeError{errors.New("no base payload for delta")}
+			}
+			// RTL20
+			if from := m.deltaFrom(); from != base.id {
+				return m, payload, &deltaDecodeError{fmt.Errorf("delta is from message %q, but the last received message is %q", from, base.id)}
+			}
+			d, err := coerceBytes(m.Data)
+			if err != nil {
+				return m, payload, &deltaDecodeError{err}
+			}
+			data, err := vcdiff.Decode(base.payload, d)
+			if err != nil {
+				return m, payload, &deltaDecodeError{err}
 			}
 			m.Data = data
+			payload = data
 		case encUTF8:
 			d, err := coerceString(m.Data)
 			if err != nil {
-				return m, err
+				return m, payload, err
 			}
 			m.Data = d
 		case encJSON:
 			d, err := coerceBytes(m.Data)
 			if err != nil {
-				return m, err
+				return m, payload, err
 			}
 			var result interface{}
 			if err := json.Unmarshal(d, &result); err != nil {
-				return m, fmt.Errorf("error unmarshaling JSON payload of type %T: %s", m.Data, err.Error())
+				return m, payload, fmt.Errorf("error unmarshaling JSON payload of type %T: %s", m.Data, err.Error())
 			}
 			m.Data = result
 		default:
 			if strings.HasPrefix(encoding, encCipher) {
 				if cipher == nil {
-					return m, fmt.Errorf("message data is encrypted as %s, but cipher wasn't provided", encoding)
+					return m, payload, fmt.Errorf("message data is encrypted as %s, but cipher wasn't provided", encoding)
 				}
 				d, err := coerceBytes(m.Data)
 				if err != nil {
-					return m, err
+					return m, payload, err
 				}
 				d, err = cipher.Decrypt(d)
 				if err != nil {
-					return m, fmt.Errorf("decrypting message data: %w", err)
+					return m, payload, fmt.Errorf("decrypting message data: %w", err)
 				}
 				m.Data = d
 			} else {
-				return m, fmt.Errorf("unknown encoding %s", encoding)
+				return m, payload, fmt.Errorf("unknown encoding %s", encoding)
 			}
 		}
 		m.Encoding = strings.Join(encodings, "/")
 	}
-	return m, nil
+	return m, payload, nil
 }
 
 func coerceString(i interface{}) (string, error) {
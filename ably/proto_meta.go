@@ -0,0 +1,109 @@
+package ably
+
+import (
+	"encoding/json"
+
+	"github.com/ably/ably-go/ably/internal/ablyutil"
+)
+
+// Metachannels, which publish events about the app's channels and
+// connections, instead of messages published by clients.
+const (
+	MetaChannelLifecycle    = "[meta]channel.lifecycle"
+	MetaConnectionLifecycle = "[meta]connection.lifecycle"
+)
+
+// Names of the messages with metadata events.
+const (
+	// MetaOccupancy is the name of the messages with occupancy metrics that
+	// channels with ChannelWithOccupancy receive.
+	MetaOccupancy = "[meta]occupancy"
+
+	MetaChannelOpened         = "channel.opened"
+	MetaChannelClosed         = "channel.closed"
+	MetaChannelRegionActive   = "channel.region.active"
+	MetaChannelRegionInactive = "channel.region.inactive"
+
+	MetaConnectionOpened = "connection.opened"
+	MetaConnectionClosed = "connection.closed"
+)
+
+// ChannelLifecycleEvent is an event published on MetaChannelLifecycle.
+type ChannelLifecycleEvent struct {
+	// Name is the event's name, e.g. MetaChannelOpened.
+	Name    string
+	Channel ChannelDetails
+}
+
+// ConnectionLifecycleEvent is an event published on MetaConnectionLifecycle.
+type ConnectionLifecycleEvent struct {
+	// Name is the event's name, e.g. MetaConnectionOpened.
+	Name       string
+	Connection ConnectionLifecycleDetails
+}
+
+// ConnectionLifecycleDetails holds the details of a connection that a
+// ConnectionLifecycleEvent is about.
+type ConnectionLifecycleDetails struct {
+	ConnectionID string `json:"connectionId" codec:"connectionId"`
+	ClientID     string `json:"clientId,omitempty" codec:"clientId,omitempty"`
+	Transport    string `json:"transport,omitempty" codec:"transport,omitempty"`
+}
+
+// DecodeOccupancy decodes the occupancy metrics in a message named
+// MetaOccupancy.
+func DecodeOccupancy(m *Message) (*ChannelOccupancy, error) {
+	if m.Name != MetaOccupancy {
+		return nil, newErrorf(ErrBadRequest, "message %q isn't an occupancy event", m.Name)
+	}
+	var occupancy ChannelOccupancy
+	if err := decodeMetaData(m.Data, &occupancy); err != nil {
+		return nil, err
+	}
+	return &occupancy, nil
+}
+
+// DecodeChannelLifecycleEvent decodes a message received on
+// MetaChannelLifecycle.
+func DecodeChannelLifecycleEvent(m *Message) (*ChannelLifecycleEvent, error) {
+	event := ChannelLifecycleEvent{Name: m.Name}
+	if err := decodeMetaData(m.Data, &event.Channel); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// DecodeConnectionLifecycleEvent decodes a message received on
+// MetaConnectionLifecycle.
+func DecodeConnectionLifecycleEvent(m *Message) (*ConnectionLifecycleEvent, error) {
+	event := ConnectionLifecycleEvent{Name: m.Name}
+	if err := decodeMetaData(m.Data, &event.Connection); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// decodeMetaData decodes the data of a metadata message into out. The data
+// is usually already decoded from JSON into a map, and from MessagePack
+// into a map with interface{} keys that JSON can't encode, so it's encoded
+// back with MessagePack then.
+func decodeMetaData(data interface{}, out interface{}) error {
+	var err error
+	switch d := data.(type) {
+	case string:
+		err = json.Unmarshal([]byte(d), out)
+	case []byte:
+		err = json.Unmarshal(d, out)
+	default:
+		var b []byte
+		if b, err = json.Marshal(d); err == nil {
+			err = json.Unmarshal(b, out)
+		} else if b, err = ablyutil.MarshalMsgpack(d); err == nil {
+			err = ablyutil.UnmarshalMsgpack(b, out)
+		}
+	}
+	if err != nil {
+		return newErrorf(ErrBadRequest, "decoding metadata of type %T: %v", data, err)
+	}
+	return nil
+}
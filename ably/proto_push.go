@@ -0,0 +1,52 @@
+package ably
+
+// PushRecipient identifies the recipient of push notifications: either
+// devices registered with Ably, by device ID or client ID, or a device of a
+// push transport, by its token.
+type PushRecipient struct {
+	DeviceID string `json:"deviceId,omitempty" codec:"deviceId,omitempty"`
+	ClientID string `json:"clientId,omitempty" codec:"clientId,omitempty"`
+
+	// TransportType is the push transport to send notifications through:
+	// "apns", "fcm" or "web".
+	TransportType string `json:"transportType,omitempty" codec:"transportType,omitempty"`
+	// DeviceToken is the APNs token of the device.
+	DeviceToken string `json:"deviceToken,omitempty" codec:"deviceToken,omitempty"`
+	// RegistrationToken is the FCM token of the device.
+	RegistrationToken string `json:"registrationToken,omitempty" codec:"registrationToken,omitempty"`
+}
+
+func (r PushRecipient) isEmpty() bool {
+	return r == PushRecipient{}
+}
+
+// DeviceDetails holds the details of a device registered to receive push
+// notifications.
+type DeviceDetails struct {
+	ID       string `json:"id" codec:"id"`
+	ClientID string `json:"clientId,omitempty" codec:"clientId,omitempty"`
+	// FormFactor is the kind of device, e.g. "phone", "tablet" or "desktop".
+	FormFactor string `json:"formFactor,omitempty" codec:"formFactor,omitempty"`
+	// Platform is the device's platform, e.g. "ios", "android" or "browser".
+	Platform     string                 `json:"platform,omitempty" codec:"platform,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty" codec:"metadata,omitempty"`
+	DeviceSecret string                 `json:"deviceSecret,omitempty" codec:"deviceSecret,omitempty"`
+	Push         DevicePushDetails      `json:"push" codec:"push"`
+}
+
+// DevicePushDetails holds how push notifications are sent to a registered
+// device.
+type DevicePushDetails struct {
+	Recipient PushRecipient `json:"recipient" codec:"recipient"`
+	// State is the state of the device's push registration: "ACTIVE",
+	// "FAILING" or "FAILED".
+	State string `json:"state,omitempty" codec:"state,omitempty"`
+}
+
+// PushChannelSubscription subscribes a device, or all the devices of a
+// client ID, to the push notifications published on a channel.
+type PushChannelSubscription struct {
+	Channel  string `json:"channel" codec:"channel"`
+	DeviceID string `json:"deviceId,omitempty" codec:"deviceId,omitempty"`
+	ClientID string `json:"clientId,omitempty" codec:"clientId,omitempty"`
+}
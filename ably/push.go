@@ -0,0 +1,539 @@
+package ably
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// Push is the interface for the push notifications API.
+type Push struct {
+	// Admin manages push notifications with the client's privileges, which
+	// must include the push-admin capability.
+	Admin *PushAdmin
+}
+
+func newPush(client *REST) *Push {
+	return &Push{
+		Admin: &PushAdmin{
+			DeviceRegistrations:  &PushDeviceRegistrations{client: client},
+			ChannelSubscriptions: &PushChannelSubscriptions{client: client},
+			client:               client,
+		},
+	}
+}
+
+// PushAdmin is the interface for publishing push notifications and managing
+// device registrations and channel subscriptions (RSH1).
+type PushAdmin struct {
+	DeviceRegistrations  *PushDeviceRegistrations
+	ChannelSubscriptions *PushChannelSubscriptions
+
+	client *REST
+}
+
+// Publish sends a push notification directly to a recipient (RSH1a).
+//
+// payload is the notification as Ably expects it, e.g.
+//
+//	map[string]interface{}{
+//		"notification": map[string]interface{}{
+//			"title": "Hello",
+//			"body":  "from Ably",
+//		},
+//	}
+func (a *PushAdmin) Publish(ctx context.Context, recipient PushRecipient, payload map[string]interface{}) error {
+	if recipient.isEmpty() {
+		return newError(ErrBadRequest, errors.New("push recipient is empty"))
+	}
+	if len(payload) == 0 {
+		return newError(ErrBadRequest, errors.New("push payload is empty"))
+	}
+	body := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		body[k] = v
+	}
+	body["recipient"] = recipient
+	res, err := a.client.post(ctx, "/push/publish", body, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// PushDeviceRegistrations is the interface for managing the devices
+// registered to receive push notifications (RSH1b).
+type PushDeviceRegistrations struct {
+	client *REST
+}
+
+func deviceRegistrationPath(id string) string {
+	return "/push/deviceRegistrations/" + url.PathEscape(id)
+}
+
+// Get gets the details of a registered device (RSH1b1).
+func (r *PushDeviceRegistrations) Get(ctx context.Context, deviceID string) (*DeviceDetails, error) {
+	var device DeviceDetails
+	if _, err := r.client.get(ctx, deviceRegistrationPath(deviceID), &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// List lists the registered devices, optionally filtered by client ID or
+// device ID (RSH1b2).
+func (r *PushDeviceRegistrations) List(o ...DeviceRegistrationsOption) DeviceRegistrationsRequest {
+	params := (&deviceRegistrationsOptions{}).apply(o...)
+	return DeviceRegistrationsRequest{r: r.client.newPaginatedRequest("/push/deviceRegistrations", params)}
+}
+
+// Save registers a device, or updates its registration, and returns its
+// details as saved (RSH1b3).
+func (r *PushDeviceRegistrations) Save(ctx context.Context, device *DeviceDetails) (*DeviceDetails, error) {
+	if device.ID == "" {
+		return nil, newError(ErrBadRequest, errors.New("device ID is empty"))
+	}
+	var saved DeviceDetails
+	req := &request{
+		Method: "PUT",
+		Path:   deviceRegistrationPath(device.ID),
+		In:     device,
+		Out:    &saved,
+	}
+	if _, err := r.client.do(ctx, req); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// Remove unregisters a device (RSH1b4). Removing a device that isn't
+// registered succeeds.
+func (r *PushDeviceRegistrations) Remove(ctx context.Context, deviceID string) error {
+	res, err := r.client.do(ctx, &request{Method: "DELETE", Path: deviceRegistrationPath(deviceID)})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// RemoveWhere unregisters the devices matching the filters, by client ID or
+// device ID (RSH1b5).
+func (r *PushDeviceRegistrations) RemoveWhere(ctx context.Context, o ...DeviceRegistrationsOption) error {
+	params := (&deviceRegistrationsOptions{}).apply(o...)
+	params.Del("limit")
+	if len(params) == 0 {
+		return newError(ErrBadRequest, errors.New("no filters to remove device registrations by"))
+	}
+	res, err := r.client.do(ctx, &request{Method: "DELETE", Path: "/push/deviceRegistrations?" + params.Encode()})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// A DeviceRegistrationsOption configures a call to
+// PushDeviceRegistrations.List or PushDeviceRegistrations.RemoveWhere.
+type DeviceRegistrationsOption func(*deviceRegistrationsOptions)
+
+// DeviceRegistrationsWithClientID filters devices by the client ID they're
+// registered for.
+func DeviceRegistrationsWithClientID(clientID string) DeviceRegistrationsOption {
+	return func(o *deviceRegistrationsOptions) {
+		o.params.Set("clientId", clientID)
+	}
+}
+
+// DeviceRegistrationsWithDeviceID filters devices by their ID.
+func DeviceRegistrationsWithDeviceID(deviceID string) DeviceRegistrationsOption {
+	return func(o *deviceRegistrationsOptions) {
+		o.params.Set("deviceId", deviceID)
+	}
+}
+
+// DeviceRegistrationsWithLimit sets the size of the pages listed; it's ignored
+// by RemoveWhere.
+func DeviceRegistrationsWithLimit(limit int) DeviceRegistrationsOption {
+	return func(o *deviceRegistrationsOptions) {
+		o.params.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+type deviceRegistrationsOptions struct {
+	params url.Values
+}
+
+func (o *deviceRegistrationsOptions) apply(opts ...DeviceRegistrationsOption) url.Values {
+	o.params = make(url.Values)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.params
+}
+
+// DeviceRegistrationsRequest represents a request prepared by the
+// PushDeviceRegistrations.List method, ready to be performed by its Pages or
+// Items methods.
+type DeviceRegistrationsRequest struct {
+	r paginatedRequest
+}
+
+// Pages returns an iterator for whole pages of device details.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r DeviceRegistrationsRequest) Pages(ctx context.Context) (*DeviceRegistrationsPaginatedResult, error) {
+	var res DeviceRegistrationsPaginatedResult
+	return &res, res.load(ctx, r.r)
+}
+
+// A DeviceRegistrationsPaginatedResult is an iterator for the result of a
+// PushDeviceRegistrations.List request.
+//
+// See "Paginated results" section in the package-level documentation.
+type DeviceRegistrationsPaginatedResult struct {
+	PaginatedResult
+	items []*DeviceDetails
+}
+
+// Next retrieves the next page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *DeviceRegistrationsPaginatedResult) Next(ctx context.Context) bool {
+	p.items = nil // avoid mutating already returned items
+	return p.next(ctx, &p.items)
+}
+
+// Items returns the current page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *DeviceRegistrationsPaginatedResult) Items() []*DeviceDetails {
+	return p.items
+}
+
+// Items returns a convenience iterator for single device details, over an
+// underlying paginated iterator.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r DeviceRegistrationsRequest) Items(ctx context.Context) (*DeviceRegistrationsPaginatedItems, error) {
+	var res DeviceRegistrationsPaginatedItems
+	var err error
+	res.next, err = res.loadItems(ctx, r.r, func() (interface{}, func() int) {
+		res.items = nil // avoid mutating already returned items
+		return &res.items, func() int { return len(res.items) }
+	})
+	return &res, err
+}
+
+type DeviceRegistrationsPaginatedItems struct {
+	PaginatedResult
+	items []*DeviceDetails
+	item  *DeviceDetails
+	next  func(context.Context) (int, bool)
+}
+
+// Next retrieves the next result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *DeviceRegistrationsPaginatedItems) Next(ctx context.Context) bool {
+	i, ok := p.next(ctx)
+	if !ok {
+		return false
+	}
+	p.item = p.items[i]
+	return true
+}
+
+// Item returns the current result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *DeviceRegistrationsPaginatedItems) Item() *DeviceDetails {
+	return p.item
+}
+
+// PushChannelSubscriptions is the interface for managing the subscriptions of
+// devices to the push notifications published on channels (RSH1c).
+type PushChannelSubscriptions struct {
+	client *REST
+}
+
+// List lists the channel subscriptions, optionally filtered by channel,
+// client ID or device ID (RSH1c1).
+func (s *PushChannelSubscriptions) List(o ...PushChannelSubscriptionsOption) PushChannelSubscriptionsRequest {
+	params := (&pushChannelSubscriptionsOptions{}).apply(o...)
+	return PushChannelSubscriptionsRequest{r: s.client.newPaginatedRequest("/push/channelSubscriptions", params)}
+}
+
+// ListChannels lists the channels with at least one subscription (RSH1c2).
+func (s *PushChannelSubscriptions) ListChannels(o ...PushChannelsOption) PushChannelsRequest {
+	params := (&pushChannelsOptions{}).apply(o...)
+	return PushChannelsRequest{r: s.client.newPaginatedRequest("/push/channels", params)}
+}
+
+// Save subscribes a device, or the devices of a client ID, to a channel, and
+// returns the subscription as saved (RSH1c3).
+func (s *PushChannelSubscriptions) Save(ctx context.Context, sub *PushChannelSubscription) (*PushChannelSubscription, error) {
+	if err := sub.validate(); err != nil {
+		return nil, err
+	}
+	var saved PushChannelSubscription
+	if _, err := s.client.post(ctx, "/push/channelSubscriptions", sub, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// Remove unsubscribes a device, or the devices of a client ID, from a channel
+// (RSH1c4).
+func (s *PushChannelSubscriptions) Remove(ctx context.Context, sub *PushChannelSubscription) error {
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	params := url.Values{"channel": {sub.Channel}}
+	if sub.DeviceID != "" {
+		params.Set("deviceId", sub.DeviceID)
+	} else {
+		params.Set("clientId", sub.ClientID)
+	}
+	res, err := s.client.do(ctx, &request{Method: "DELETE", Path: "/push/channelSubscriptions?" + params.Encode()})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (sub *PushChannelSubscription) validate() error {
+	switch {
+	case sub.Channel == "":
+		return newError(ErrBadRequest, errors.New("push channel subscription has no channel"))
+	case (sub.DeviceID == "") == (sub.ClientID == ""):
+		return newError(ErrBadRequest, errors.New("push channel subscription must have either a device ID or a client ID"))
+	}
+	return nil
+}
+
+// A PushChannelSubscriptionsOption configures a call to
+// PushChannelSubscriptions.List.
+type PushChannelSubscriptionsOption func(*pushChannelSubscriptionsOptions)
+
+// PushChannelSubscriptionsWithChannel filters subscriptions by channel.
+func PushChannelSubscriptionsWithChannel(channel string) PushChannelSubscriptionsOption {
+	return func(o *pushChannelSubscriptionsOptions) {
+		o.params.Set("channel", channel)
+	}
+}
+
+// PushChannelSubscriptionsWithClientID filters subscriptions by the client
+// ID subscribed.
+func PushChannelSubscriptionsWithClientID(clientID string) PushChannelSubscriptionsOption {
+	return func(o *pushChannelSubscriptionsOptions) {
+		o.params.Set("clientId", clientID)
+	}
+}
+
+// PushChannelSubscriptionsWithDeviceID filters subscriptions by the device
+// ID subscribed.
+func PushChannelSubscriptionsWithDeviceID(deviceID string) PushChannelSubscriptionsOption {
+	return func(o *pushChannelSubscriptionsOptions) {
+		o.params.Set("deviceId", deviceID)
+	}
+}
+
+// PushChannelSubscriptionsWithLimit sets the size of the pages listed.
+func PushChannelSubscriptionsWithLimit(limit int) PushChannelSubscriptionsOption {
+	return func(o *pushChannelSubscriptionsOptions) {
+		o.params.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+type pushChannelSubscriptionsOptions struct {
+	params url.Values
+}
+
+func (o *pushChannelSubscriptionsOptions) apply(opts ...PushChannelSubscriptionsOption) url.Values {
+	o.params = make(url.Values)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.params
+}
+
+// PushChannelSubscriptionsRequest represents a request prepared by the
+// PushChannelSubscriptions.List method, ready to be performed by its Pages or
+// Items methods.
+type PushChannelSubscriptionsRequest struct {
+	r paginatedRequest
+}
+
+// Pages returns an iterator for whole pages of channel subscriptions.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r PushChannelSubscriptionsRequest) Pages(ctx context.Context) (*PushChannelSubscriptionsPaginatedResult, error) {
+	var res PushChannelSubscriptionsPaginatedResult
+	return &res, res.load(ctx, r.r)
+}
+
+// A PushChannelSubscriptionsPaginatedResult is an iterator for the result of a
+// PushChannelSubscriptions.List request.
+//
+// See "Paginated results" section in the package-level documentation.
+type PushChannelSubscriptionsPaginatedResult struct {
+	PaginatedResult
+	items []*PushChannelSubscription
+}
+
+// Next retrieves the next page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelSubscriptionsPaginatedResult) Next(ctx context.Context) bool {
+	p.items = nil // avoid mutating already returned items
+	return p.next(ctx, &p.items)
+}
+
+// Items returns the current page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelSubscriptionsPaginatedResult) Items() []*PushChannelSubscription {
+	return p.items
+}
+
+// Items returns a convenience iterator for single channel subscriptions, over
+// an underlying paginated iterator.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r PushChannelSubscriptionsRequest) Items(ctx context.Context) (*PushChannelSubscriptionsPaginatedItems, error) {
+	var res PushChannelSubscriptionsPaginatedItems
+	var err error
+	res.next, err = res.loadItems(ctx, r.r, func() (interface{}, func() int) {
+		res.items = nil // avoid mutating already returned items
+		return &res.items, func() int { return len(res.items) }
+	})
+	return &res, err
+}
+
+type PushChannelSubscriptionsPaginatedItems struct {
+	PaginatedResult
+	items []*PushChannelSubscription
+	item  *PushChannelSubscription
+	next  func(context.Context) (int, bool)
+}
+
+// Next retrieves the next result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelSubscriptionsPaginatedItems) Next(ctx context.Context) bool {
+	i, ok := p.next(ctx)
+	if !ok {
+		return false
+	}
+	p.item = p.items[i]
+	return true
+}
+
+// Item returns the current result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelSubscriptionsPaginatedItems) Item() *PushChannelSubscription {
+	return p.item
+}
+
+// A PushChannelsOption configures a call to
+// PushChannelSubscriptions.ListChannels.
+type PushChannelsOption func(*pushChannelsOptions)
+
+// PushChannelsWithLimit sets the size of the pages listed.
+func PushChannelsWithLimit(limit int) PushChannelsOption {
+	return func(o *pushChannelsOptions) {
+		o.params.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+type pushChannelsOptions struct {
+	params url.Values
+}
+
+func (o *pushChannelsOptions) apply(opts ...PushChannelsOption) url.Values {
+	o.params = make(url.Values)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.params
+}
+
+// PushChannelsRequest represents a request prepared by the
+// PushChannelSubscriptions.ListChannels method, ready to be performed by its
+// Pages or Items methods.
+type PushChannelsRequest struct {
+	r paginatedRequest
+}
+
+// Pages returns an iterator for whole pages of channel names.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r PushChannelsRequest) Pages(ctx context.Context) (*PushChannelsPaginatedResult, error) {
+	var res PushChannelsPaginatedResult
+	return &res, res.load(ctx, r.r)
+}
+
+// A PushChannelsPaginatedResult is an iterator for the result of a
+// PushChannelSubscriptions.ListChannels request.
+//
+// See "Paginated results" section in the package-level documentation.
+type PushChannelsPaginatedResult struct {
+	PaginatedResult
+	items []string
+}
+
+// Next retrieves the next page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelsPaginatedResult) Next(ctx context.Context) bool {
+	p.items = nil // avoid mutating already returned items
+	return p.next(ctx, &p.items)
+}
+
+// Items returns the current page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelsPaginatedResult) Items() []string {
+	return p.items
+}
+
+// Items returns a convenience iterator for single channel names, over an
+// underlying paginated iterator.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r PushChannelsRequest) Items(ctx context.Context) (*PushChannelsPaginatedItems, error) {
+	var res PushChannelsPaginatedItems
+	var err error
+	res.next, err = res.loadItems(ctx, r.r, func() (interface{}, func() int) {
+		res.items = nil // avoid mutating already returned items
+		return &res.items, func() int { return len(res.items) }
+	})
+	return &res, err
+}
+
+type PushChannelsPaginatedItems struct {
+	PaginatedResult
+	items []string
+	item  string
+	next  func(context.Context) (int, bool)
+}
+
+// Next retrieves the next result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelsPaginatedItems) Next(ctx context.Context) bool {
+	i, ok := p.next(ctx)
+	if !ok {
+		return false
+	}
+	p.item = p.items[i]
+	return true
+}
+
+// Item returns the current result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *PushChannelsPaginatedItems) Item() string {
+	return p.item
+}
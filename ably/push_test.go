@@ -0,0 +1,239 @@
+package ably_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ably/ably-go/ably"
+)
+
+func TestPushAdmin(t *testing.T) {
+	type request struct {
+		method string
+		uri    string
+		body   map[string]interface{}
+	}
+	type response struct {
+		link string
+		body string
+	}
+	var requests []request
+	// responses maps "METHOD URI" to the response; requests not in it get
+	// 204 No Content.
+	responses := map[string]response{}
+
+	client, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				r := request{method: req.Method, uri: req.URL.RequestURI()}
+				if req.Body != nil {
+					b, err := ioutil.ReadAll(req.Body)
+					if err != nil {
+						return nil, err
+					}
+					if len(b) > 0 {
+						if err := json.Unmarshal(b, &r.body); err != nil {
+							return nil, err
+						}
+					}
+				}
+				requests = append(requests, r)
+
+				rec := httptest.NewRecorder()
+				res, ok := responses[r.method+" "+r.uri]
+				if !ok {
+					rec.WriteHeader(http.StatusNoContent)
+					return rec.Result(), nil
+				}
+				rec.Header().Set("Content-Type", "application/json")
+				if res.link != "" {
+					rec.Header().Set("Link", res.link)
+				}
+				fmt.Fprint(rec, res.body)
+				return rec.Result(), nil
+			}),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	admin := client.Push.Admin
+
+	lastRequest := func(t *testing.T, method, uri string) request {
+		t.Helper()
+		if len(requests) == 0 {
+			t.Fatalf("expected a request")
+		}
+		r := requests[len(requests)-1]
+		if r.method != method || r.uri != uri {
+			t.Fatalf("expected request %s %s; got %s %s", method, uri, r.method, r.uri)
+		}
+		return r
+	}
+
+	t.Run("Publish", func(t *testing.T) {
+		err := admin.Publish(ctx, ably.PushRecipient{ClientID: "alice"}, map[string]interface{}{
+			"notification": map[string]interface{}{"title": "Hello"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := lastRequest(t, "POST", "/push/publish")
+		expected := map[string]interface{}{
+			"recipient":    map[string]interface{}{"clientId": "alice"},
+			"notification": map[string]interface{}{"title": "Hello"},
+		}
+		if !reflect.DeepEqual(expected, r.body) {
+			t.Errorf("expected body %v; got %v", expected, r.body)
+		}
+
+		err = admin.Publish(ctx, ably.PushRecipient{}, map[string]interface{}{"data": "x"})
+		if expected, got := ably.ErrBadRequest, ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d for empty recipient; got %v", expected, err)
+		}
+	})
+
+	t.Run("DeviceRegistrations", func(t *testing.T) {
+		device := `{"id": "device 1", "clientId": "alice", "platform": "ios", "formFactor": "phone",
+			"push": {"recipient": {"transportType": "apns", "deviceToken": "token"}, "state": "ACTIVE"}}`
+		responses["GET /push/deviceRegistrations/device%201"] = response{body: device}
+		responses["PUT /push/deviceRegistrations/device%201"] = response{body: device}
+		responses["GET /push/deviceRegistrations?clientId=alice"] = response{
+			link: `<./deviceRegistrations?clientId=alice&cursor=1>; rel="next"`,
+			body: "[" + device + "]",
+		}
+		responses["GET /push/deviceRegistrations?clientId=alice&cursor=1"] = response{
+			body: `[{"id": "device 2", "clientId": "alice", "push": {"recipient": {"transportType": "fcm", "registrationToken": "token"}}}]`,
+		}
+		expected := &ably.DeviceDetails{
+			ID:         "device 1",
+			ClientID:   "alice",
+			Platform:   "ios",
+			FormFactor: "phone",
+			Push: ably.DevicePushDetails{
+				Recipient: ably.PushRecipient{TransportType: "apns", DeviceToken: "token"},
+				State:     "ACTIVE",
+			},
+		}
+
+		got, err := admin.DeviceRegistrations.Get(ctx, "device 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %+v; got %+v", expected, got)
+		}
+
+		saved, err := admin.DeviceRegistrations.Save(ctx, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := lastRequest(t, "PUT", "/push/deviceRegistrations/device%201")
+		if expected, got := "apns", r.body["push"].(map[string]interface{})["recipient"].(map[string]interface{})["transportType"]; expected != got {
+			t.Errorf("expected transport type %v; got %v", expected, got)
+		}
+		if !reflect.DeepEqual(expected, saved) {
+			t.Errorf("expected %+v; got %+v", expected, saved)
+		}
+
+		items, err := admin.DeviceRegistrations.List(ably.DeviceRegistrationsWithClientID("alice")).Items(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for items.Next(ctx) {
+			ids = append(ids, items.Item().ID)
+		}
+		if err := items.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := []string{"device 1", "device 2"}, ids; !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected devices %v; got %v", expected, got)
+		}
+
+		if err := admin.DeviceRegistrations.Remove(ctx, "device 1"); err != nil {
+			t.Fatal(err)
+		}
+		lastRequest(t, "DELETE", "/push/deviceRegistrations/device%201")
+
+		if err := admin.DeviceRegistrations.RemoveWhere(ctx, ably.DeviceRegistrationsWithClientID("alice")); err != nil {
+			t.Fatal(err)
+		}
+		lastRequest(t, "DELETE", "/push/deviceRegistrations?clientId=alice")
+
+		err = admin.DeviceRegistrations.RemoveWhere(ctx)
+		if expected, got := ably.ErrBadRequest, ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d removing without filters; got %v", expected, err)
+		}
+	})
+
+	t.Run("ChannelSubscriptions", func(t *testing.T) {
+		responses["POST /push/channelSubscriptions"] = response{
+			body: `{"channel": "news", "deviceId": "device 1"}`,
+		}
+		responses["GET /push/channelSubscriptions?channel=news"] = response{
+			body: `[{"channel": "news", "deviceId": "device 1"}, {"channel": "news", "clientId": "bob"}]`,
+		}
+		responses["GET /push/channels?limit=2"] = response{
+			body: `["news", "sports"]`,
+		}
+
+		sub := &ably.PushChannelSubscription{Channel: "news", DeviceID: "device 1"}
+		saved, err := admin.ChannelSubscriptions.Save(ctx, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := lastRequest(t, "POST", "/push/channelSubscriptions")
+		if expected := map[string]interface{}{"channel": "news", "deviceId": "device 1"}; !reflect.DeepEqual(expected, r.body) {
+			t.Errorf("expected body %v; got %v", expected, r.body)
+		}
+		if !reflect.DeepEqual(sub, saved) {
+			t.Errorf("expected %+v; got %+v", sub, saved)
+		}
+
+		pages, err := admin.ChannelSubscriptions.List(ably.PushChannelSubscriptionsWithChannel("news")).Pages(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pages.Next(ctx) {
+			t.Fatal(pages.Err())
+		}
+		expected := []*ably.PushChannelSubscription{
+			{Channel: "news", DeviceID: "device 1"},
+			{Channel: "news", ClientID: "bob"},
+		}
+		if got := pages.Items(); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %+v; got %+v", expected, got)
+		}
+
+		channels, err := admin.ChannelSubscriptions.ListChannels(ably.PushChannelsWithLimit(2)).Pages(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !channels.Next(ctx) {
+			t.Fatal(channels.Err())
+		}
+		if expected, got := []string{"news", "sports"}, channels.Items(); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected channels %v; got %v", expected, got)
+		}
+
+		if err := admin.ChannelSubscriptions.Remove(ctx, &ably.PushChannelSubscription{Channel: "news", ClientID: "bob"}); err != nil {
+			t.Fatal(err)
+		}
+		lastRequest(t, "DELETE", "/push/channelSubscriptions?channel=news&clientId=bob")
+
+		err = admin.ChannelSubscriptions.Remove(ctx, &ably.PushChannelSubscription{Channel: "news"})
+		if expected, got := ably.ErrBadRequest, ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d without device or client ID; got %v", expected, err)
+		}
+	})
+}
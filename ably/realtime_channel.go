@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var (
@@ -81,6 +83,41 @@ func ChannelWithModes(modes ...ChannelMode) ChannelOption {
 	}
 }
 
+// ChannelWithRewind makes the channel receive the last n messages published
+// on it, if any, as soon as it attaches (RTL4k).
+func ChannelWithRewind(n int) ChannelOption {
+	return ChannelWithParams("rewind", strconv.Itoa(n))
+}
+
+// ChannelWithRewindDuration makes the channel receive the messages published
+// on it within the given duration before it attaches (RTL4k). The duration
+// is sent with a granularity of seconds, truncating any fraction; durations
+// below one second, including zero and negative ones, rewind one second.
+func ChannelWithRewindDuration(d time.Duration) ChannelOption {
+	if d < time.Second {
+		d = time.Second
+	}
+	rewind := fmt.Sprintf("%ds", int64(d/time.Second))
+	if d%time.Minute == 0 {
+		rewind = fmt.Sprintf("%dm", int64(d/time.Minute))
+	}
+	return ChannelWithParams("rewind", rewind)
+}
+
+// ChannelWithOccupancy makes the channel receive occupancy metrics events,
+// with the number of connections, publishers, subscribers, etc. on the
+// channel.
+func ChannelWithOccupancy() ChannelOption {
+	return ChannelWithParams("occupancy", "metrics")
+}
+
+// ChannelWithDelta makes the channel receive messages as vcdiff deltas from
+// the previous message, which are decoded transparently before being
+// delivered to subscribers (RTL19).
+func ChannelWithDelta() ChannelOption {
+	return ChannelWithParams("delta", "vcdiff")
+}
+
 func applyChannelOptions(os ...ChannelOption) *channelOptions {
 	to := channelOptions{}
 	for _, set := range os {
@@ -95,8 +132,13 @@ func applyChannelOptions(os ...ChannelOption) *channelOptions {
 // It is safe to call Get from multiple goroutines - a single channel is
 // guaranteed to be created only once for multiple calls to Get from different
 // goroutines.
+//
+// If the channel already exists and options are given, they're added to the
+// channel's options: params are added to the existing ones, and the cipher and
+// modes are replaced only if given. The channel then reattaches if its params
+// or modes changed, as with RealtimeChannel.SetOptions, except that Get doesn't
+// wait for it (RTS3c).
 func (ch *RealtimeChannels) Get(name string, options ...ChannelOption) *RealtimeChannel {
-	// TODO: options
 	ch.mtx.Lock()
 	c, ok := ch.chans[name]
 	if !ok {
@@ -104,6 +146,11 @@ func (ch *RealtimeChannels) Get(name string, options ...ChannelOption) *Realtime
 		ch.chans[name] = c
 	}
 	ch.mtx.Unlock()
+	if ok && len(options) > 0 {
+		if _, err := c.addOptions(applyChannelOptions(options...)); err != nil {
+			c.log().Errorf("Couldn't reattach channel %q with new options: %v", name, err)
+		}
+	}
 	return c
 }
 
@@ -173,6 +220,16 @@ type RealtimeChannel struct {
 	options        *channelOptions
 	params         channelParams
 	modes          []ChannelMode
+	// attachSerial is the channel serial from the last ATTACHED message,
+	// used by HistoryWithUntilAttach.
+	attachSerial string
+	// channelSerial is the channel serial from the last processed MESSAGE.
+	channelSerial string
+	// decodeFailureSerial is the channelSerial to reattach from after
+	// failing to decode a delta message (RTL18c).
+	decodeFailureSerial string
+	// deltaBase is only accessed from the connection's event loop.
+	deltaBase deltaBase
 
 	//attachResume is True when the channel moves to the ChannelStateAttached state, and False
 	//when the channel moves to the ChannelStateDetaching or ChannelStateFailed states.
@@ -200,6 +257,13 @@ func (c *RealtimeChannel) onConnStateChange(change ConnectionStateChange) {
 	switch change.Current {
 	case ConnectionStateConnected:
 		c.queue.Flush()
+	case ConnectionStateSuspended:
+		// RTL3c
+		c.mtx.Lock()
+		if c.isActive() {
+			c.lockSetState(ChannelStateSuspended, change.Reason, false)
+		}
+		c.mtx.Unlock()
 	case ConnectionStateFailed:
 		c.setState(ChannelStateFailed, change.Reason, false)
 		c.queue.Fail(change.Reason)
@@ -225,8 +289,14 @@ func (c *RealtimeChannel) Attach(ctx context.Context) error {
 	go func() {
 		err := res.Wait(timeoutCtx)
 		if errors.Is(err, context.DeadlineExceeded) {
+			// RTL4f
 			err = newError(ErrTimeoutError, errors.New("timed out before attaching channel"))
-			c.setState(ChannelStateSuspended, err, false)
+			c.mtx.Lock()
+			if c.state == ChannelStateAttaching {
+				c.lockStartRetryAttachLoop(err)
+			} else {
+				c.mtx.Unlock()
+			}
 		}
 		internalOpErr <- err
 	}()
@@ -286,6 +356,9 @@ func (c *RealtimeChannel) lockAttach(err error) (result, error) {
 		if c.attachResume {
 			msg.Flags.Set(flagAttachResume)
 		}
+		if c.decodeFailureSerial != "" {
+			msg.ChannelSerial = c.decodeFailureSerial // RTL18c
+		}
 		c.client.Connection.send(msg, nil)
 		return res, nil
 	}
@@ -419,6 +492,9 @@ func (*subscriptionMessage) isEmitterData() {}
 // See package-level documentation on Event Emitter for details about
 // messages dispatch.
 func (c *RealtimeChannel) Subscribe(ctx context.Context, name string, handle func(*Message)) (unsubscribe func(), err error) {
+	if err := c.client.Auth.checkCapability(c.Name, CapabilitySubscribe); err != nil {
+		return nil, err
+	}
 	res, err := c.attach()
 	if err != nil {
 		return nil, err
@@ -443,6 +519,9 @@ func (c *RealtimeChannel) Subscribe(ctx context.Context, name string, handle fun
 // See package-level documentation on Event Emitter for details about
 // messages dispatch.
 func (c *RealtimeChannel) SubscribeAll(ctx context.Context, handle func(*Message)) (unsubscribe func(), err error) {
+	if err := c.client.Auth.checkCapability(c.Name, CapabilitySubscribe); err != nil {
+		return nil, err
+	}
 	res, err := c.attach()
 	if err != nil {
 		return nil, err
@@ -456,6 +535,22 @@ func (c *RealtimeChannel) SubscribeAll(ctx context.Context, handle func(*Message
 	}), nil
 }
 
+// OnOccupancy registers a handler to be called with the occupancy metrics
+// of the channel, which it receives if it has ChannelWithOccupancy, when
+// they change.
+//
+// Like Subscribe, this implicitly attaches the channel.
+func (c *RealtimeChannel) OnOccupancy(ctx context.Context, handle func(*ChannelOccupancy)) (unsubscribe func(), err error) {
+	return c.Subscribe(ctx, MetaOccupancy, func(m *Message) {
+		occupancy, err := DecodeOccupancy(m)
+		if err != nil {
+			c.log().Errorf("Couldn't decode occupancy metrics from channel %q: %v", c.Name, err)
+			return
+		}
+		handle(occupancy)
+	})
+}
+
 type channelStateChanges chan ChannelStateChange
 
 func (c channelStateChanges) Receive(change ChannelStateChange) {
@@ -540,10 +635,23 @@ func (c *RealtimeChannel) PublishMultiple(ctx context.Context, messages []*Messa
 			return fmt.Errorf("Unable to publish message containing a clientId (%s) that is incompatible with the library clientId (%s)", v.ClientID, id)
 		}
 	}
+	if err := c.client.Auth.checkCapability(c.Name, CapabilityPublish); err != nil {
+		return err
+	}
+	// RTL6a: messages are encoded and encrypted like in RSL4 and RSL5.
+	cipher := c.cipher()
+	encoded := make([]*Message, 0, len(messages))
+	for i, m := range messages {
+		m, err := (*m).withEncodedData(cipher)
+		if err != nil {
+			return fmt.Errorf("encoding data for message #%d: %w", i, err)
+		}
+		encoded = append(encoded, &m)
+	}
 	msg := &protocolMessage{
 		Action:   actionMessage,
 		Channel:  c.Name,
-		Messages: messages,
+		Messages: encoded,
 	}
 	res, err := c.send(msg)
 	if err != nil {
@@ -552,9 +660,44 @@ func (c *RealtimeChannel) PublishMultiple(ctx context.Context, messages []*Messa
 	return res.Wait(ctx)
 }
 
-// History is equivalent to RESTChannel.History.
+// History is equivalent to RESTChannel.History, except that it also
+// supports HistoryWithUntilAttach, which requires the channel to be attached.
 func (c *RealtimeChannel) History(o ...HistoryOption) HistoryRequest {
-	return c.client.rest.Channels.Get(c.Name).History(o...)
+	var opts historyOptions
+	params := opts.apply(o...)
+	rest := c.restChannel()
+	if opts.untilAttach { // RTL10b
+		c.mtx.Lock()
+		state, attachSerial := c.state, c.attachSerial
+		c.mtx.Unlock()
+		if state != ChannelStateAttached {
+			req := rest.history(params)
+			req.err = newError(ErrChannelOperationFailedInvalidChannelState,
+				fmt.Errorf("untilAttach requires the channel to be attached; channel is %v", state))
+			return req
+		}
+		params.Set("fromSerial", attachSerial)
+	}
+	return rest.history(params)
+}
+
+// restChannel returns a REST counterpart of the channel with a copy of its
+// options, so that history is decoded with the same cipher. It isn't the one
+// in c.client.rest.Channels, whose options are the user's to set.
+func (c *RealtimeChannel) restChannel() *RESTChannel {
+	c.mtx.Lock()
+	var opts *protoChannelOptions
+	if c.options != nil {
+		o := *(*protoChannelOptions)(c.options)
+		// Set the cipher now, as GetCipher would on first use, so that
+		// concurrent requests don't.
+		o.cipher, _ = (*protoChannelOptions)(c.options).GetCipher()
+		opts = &o
+	}
+	c.mtx.Unlock()
+	rest := newRESTChannel(c.Name, c.client.rest)
+	rest.options = opts
+	return rest
 }
 
 func (c *RealtimeChannel) send(msg *protocolMessage) (result, error) {
@@ -636,6 +779,10 @@ func (c *RealtimeChannel) notify(msg *protocolMessage) {
 			c.sendDetachMsg()
 			return
 		}
+		c.mtx.Lock()
+		c.attachSerial = msg.ChannelSerial // RTL10b
+		c.decodeFailureSerial = ""
+		c.mtx.Unlock()
 		if len(msg.Params) > 0 {
 			c.setParams(msg.Params)
 		}
@@ -646,6 +793,12 @@ func (c *RealtimeChannel) notify(msg *protocolMessage) {
 		// RTL12
 		c.setState(ChannelStateAttached, newErrorFromProto(msg.Error), msg.Flags.Has(flagResumed))
 		c.queue.Flush()
+		if !msg.Flags.Has(flagResumed) {
+			// RTP17i: presence members aren't kept by the server; waiting
+			// for the re-entered members' ACKs needs this goroutine to
+			// carry on.
+			go c.Presence.enterInternalMembers()
+		}
 	case actionDetached:
 		c.mtx.Lock()
 		err := error(newErrorFromProto(msg.Error))
@@ -654,7 +807,7 @@ func (c *RealtimeChannel) notify(msg *protocolMessage) {
 			c.lockSetState(ChannelStateDetached, err, false)
 			c.mtx.Unlock()
 			return
-		case ChannelStateAttached: // TODO: Also SUSPENDED; RTL13a
+		case ChannelStateAttached, ChannelStateSuspended: // RTL13a
 			var res result
 			res, err = c.lockAttach(err)
 			if err != nil {
@@ -675,9 +828,7 @@ func (c *RealtimeChannel) notify(msg *protocolMessage) {
 				c.lockStartRetryAttachLoop(err)
 			}()
 			return
-		case
-			ChannelStateAttaching,
-			ChannelStateDetached: // TODO: Should be SUSPENDED
+		case ChannelStateAttaching: // RTL13b
 		default:
 			c.mtx.Unlock()
 			return
@@ -693,17 +844,55 @@ func (c *RealtimeChannel) notify(msg *protocolMessage) {
 		c.queue.Fail(newErrorFromProto(msg.Error))
 	case actionMessage:
 		if c.State() == ChannelStateAttached {
-			for _, msg := range msg.Messages {
-				c.messageEmitter.Emit(subscriptionName(msg.Name), (*subscriptionMessage)(msg))
+			cipher := c.cipher()
+			for i, m := range msg.Messages {
+				if m.ID == "" && msg.ID != "" {
+					m.ID = fmt.Sprintf("%s:%d", msg.ID, i) // TM2a
+				}
+				decoded, err := m.withDeltaDecodedData(cipher, &c.deltaBase)
+				var deltaErr *deltaDecodeError
+				if errors.As(err, &deltaErr) {
+					// RTL18: discard the rest of the messages and recover.
+					c.log().Errorf("Couldn't decode delta message from channel %q: %v", c.Name, err)
+					c.startDecodeFailureRecovery(err)
+					return
+				}
+				if err != nil {
+					// RTL7e: deliver the message with the residual encoding.
+					c.log().Errorf("Couldn't fully decode message data from channel %q: %v", c.Name, err)
+				}
+				c.messageEmitter.Emit(subscriptionName(decoded.Name), (*subscriptionMessage)(&decoded))
 			}
+			c.mtx.Lock()
+			c.channelSerial = msg.ChannelSerial
+			c.mtx.Unlock()
 		}
 	default:
 	}
 }
 
+// startDecodeFailureRecovery reattaches the channel from the last message it
+// successfully processed, after failing to decode a delta message (RTL18).
+func (c *RealtimeChannel) startDecodeFailureRecovery(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.state != ChannelStateAttached {
+		return
+	}
+	c.decodeFailureSerial = c.channelSerial // RTL18c
+
+	// RTL18b
+	if _, err := c.lockAttach(newError(errDeltaDecodeFailure, err)); err != nil {
+		c.log().Errorf("Couldn't reattach channel %q after failing to decode a delta message: %v", c.Name, err)
+	}
+}
+
+// lockStartRetryAttachLoop moves the channel to SUSPENDED and retries
+// attaching it every ChannelRetryTimeout, until it succeeds, the channel
+// state changes for some other reason, or the connection isn't CONNECTED
+// anymore (RTL13b).
 func (c *RealtimeChannel) lockStartRetryAttachLoop(err error) {
-	// TODO: Move to SUSPENDED; move it to DETACHED for now.
-	c.lockSetState(ChannelStateDetached, err, false)
+	c.lockSetState(ChannelStateSuspended, err, false)
 
 	stateChange := make(channelStateChanges, 1)
 	off := c.internalEmitter.OnceAll(stateChange.Receive)
@@ -737,8 +926,7 @@ func (c *RealtimeChannel) retryAttach(stateChange channelStateChanges) (done boo
 	if err == nil {
 		return true
 	}
-	// TODO: Move to SUSPENDED; move it to DETACHED for now.
-	c.setState(ChannelStateDetached, err, false)
+	c.setState(ChannelStateSuspended, err, false)
 	return false
 }
 
@@ -750,6 +938,97 @@ func (c *RealtimeChannel) channelOpts() *channelOptions {
 	return c.options
 }
 
+// SetOptions replaces the channel's options (RTL16). If the channel params
+// or modes change while the channel is ATTACHED or ATTACHING, the channel
+// reattaches with them and SetOptions waits until it's ATTACHED again
+// (RTL16a).
+//
+// If the context is canceled before the reattach operation finishes, the
+// call returns with an error, but the operation carries on in the
+// background.
+func (c *RealtimeChannel) SetOptions(ctx context.Context, options ...ChannelOption) error {
+	res, err := c.setOptions(applyChannelOptions(options...))
+	if err != nil {
+		return err
+	}
+	return res.Wait(ctx)
+}
+
+func (c *RealtimeChannel) setOptions(options *channelOptions) (result, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.lockSetOptions(options)
+}
+
+// addOptions is like setOptions, but keeps the channel's current options that
+// aren't set in options.
+func (c *RealtimeChannel) addOptions(options *channelOptions) (result, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	merged := channelOptions{
+		Cipher: c.options.Cipher,
+		cipher: c.options.cipher,
+		Modes:  c.options.Modes,
+	}
+	if options.Cipher.Key != nil {
+		merged.Cipher = options.Cipher
+		merged.cipher = nil
+	}
+	for _, params := range []channelParams{c.options.Params, options.Params} {
+		for k, v := range params {
+			if merged.Params == nil {
+				merged.Params = channelParams{}
+			}
+			merged.Params[k] = v
+		}
+	}
+	if len(options.Modes) > 0 {
+		merged.Modes = options.Modes
+	}
+	return c.lockSetOptions(&merged)
+}
+
+func (c *RealtimeChannel) lockSetOptions(options *channelOptions) (result, error) {
+	reattach := !sameAttachOptions(c.options, options)
+	c.options = options
+	if !reattach {
+		return nopResult, nil
+	}
+	switch c.state {
+	case ChannelStateAttached, ChannelStateAttaching:
+		return c.lockAttach(nil)
+	}
+	return nopResult, nil
+}
+
+// sameAttachOptions returns true if a and b have the same options sent in
+// ATTACH messages, ie. params and modes.
+func sameAttachOptions(a, b *channelOptions) bool {
+	if len(a.Params) != len(b.Params) || len(a.Modes) != len(b.Modes) {
+		return false
+	}
+	for k, v := range a.Params {
+		if bv, ok := b.Params[k]; !ok || bv != v {
+			return false
+		}
+	}
+	for i, mode := range a.Modes {
+		if b.Modes[i] != mode {
+			return false
+		}
+	}
+	return true
+}
+
+// cipher returns the cipher configured for the channel, or nil if messages
+// on the channel aren't encrypted.
+func (c *RealtimeChannel) cipher() channelCipher {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	cipher, _ := (*protoChannelOptions)(c.options).GetCipher()
+	return cipher
+}
+
 func (c *RealtimeChannel) setParams(params channelParams) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
@@ -826,5 +1105,19 @@ func (c *RealtimeChannel) lockSetState(state ChannelState, err error, resumed bo
 	}
 	c.internalEmitter.emitter.Emit(change.Event, change)
 	c.emitter.Emit(change.Event, change)
+	if state == ChannelStateDetached || state == ChannelStateFailed {
+		c.Presence.clearInternalMembers() // RTP5a
+	}
 	return c.errorReason.unwrapNil()
 }
+
+// emitUpdate emits an UPDATE event with the given error, if the channel is
+// still ATTACHED.
+func (c *RealtimeChannel) emitUpdate(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.state != ChannelStateAttached {
+		return
+	}
+	c.lockSetState(ChannelStateAttached, err, true)
+}
@@ -1,11 +1,16 @@
 package ably_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strings"
 	"sync/atomic"
@@ -741,6 +746,22 @@ func TestRealtimeChannel_RTL4_Attach(t *testing.T) {
 			t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
 		}
 		ablytest.Instantly.NoRecv(t, &change, stateChanges, t.Fatalf)
+
+		// RTL13b: expect an attempt to attach after channelRetryTimeout.
+		ablytest.Instantly.Recv(t, &afterCall, afterCalls, t.Fatalf)
+		if expected, got := channelRetryTimeout, afterCall.D; expected != got {
+			t.Fatalf("expected %v; got %v", expected, got)
+		}
+		afterCall.Fire()
+
+		ablytest.Instantly.Recv(t, &change, stateChanges, t.Fatalf)
+		if expected, got := ably.ChannelStateAttaching, change.Current; expected != got {
+			t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+		}
+		ablytest.Instantly.Recv(t, &outMsg, out, t.Fatalf)
+		if expected, got := ably.ActionAttach, outMsg.Action; expected != got {
+			t.Fatalf("expected %v; got %v (event: %+v)", expected, got, outMsg.Action)
+		}
 	})
 
 	t.Run("RTL4g: If channel in FAILED state, set err to null and proceed with attach", func(t *testing.T) {
@@ -2825,7 +2846,7 @@ func TestRealtimeChannel_RTL13_HandleDetached(t *testing.T) {
 
 		var change ably.ChannelStateChange
 		ablytest.Instantly.Recv(t, &change, stateChanges, t.Fatalf)
-		if expected, got := ably.ChannelStateDetached, change.Current; expected != got {
+		if expected, got := ably.ChannelStateSuspended, change.Current; expected != got {
 			t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
 		}
 		if got := fmt.Sprint(change.Reason); !strings.Contains(got, errInfo.Message) {
@@ -2894,7 +2915,7 @@ func TestRealtimeChannel_RTL13_HandleDetached(t *testing.T) {
 
 		var change ably.ChannelStateChange
 		ablytest.Instantly.Recv(t, &change, stateChanges, t.Fatalf)
-		if expected, got := ably.ChannelStateDetached, change.Current; expected != got {
+		if expected, got := ably.ChannelStateSuspended, change.Current; expected != got {
 			t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
 		}
 		if got := fmt.Sprint(change.Reason); !strings.Contains(got, errInfo.Message) {
@@ -3154,3 +3175,692 @@ func TestRealtimeChannel_RTL14_HandleChannelError(t *testing.T) {
 		ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
 	})
 }
+
+func TestRealtimeChannel_RTL6a_RTL7d_EncodeDecodeMessages(t *testing.T) {
+
+	key, err := ably.Crypto.GenerateRandomKey(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := ably.NewCBCCipher(ably.Crypto.GetDefaultParams(ably.CipherParams{Key: key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setup := func(t *testing.T) (
+		in, out chan *ably.ProtocolMessage,
+		channel *ably.RealtimeChannel,
+	) {
+		in = make(chan *ably.ProtocolMessage, 1)
+		out = make(chan *ably.ProtocolMessage, 16)
+
+		c, _ := ably.NewRealtime(
+			ably.WithToken("fake:token"),
+			ably.WithAutoConnect(false),
+			ably.WithDial(MessagePipe(in, out)),
+		)
+
+		in <- &ably.ProtocolMessage{
+			Action:            ably.ActionConnected,
+			ConnectionID:      "connection-id",
+			ConnectionDetails: &ably.ConnectionDetails{},
+		}
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channel = c.Channels.Get("test", ably.ChannelWithCipherKey(key))
+
+		attached := make(chan error, 1)
+		go func() {
+			attached <- channel.Attach(context.Background())
+		}()
+		ablytest.Instantly.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+		in <- &ably.ProtocolMessage{
+			Action:  ably.ActionAttached,
+			Channel: channel.Name,
+		}
+		ablytest.Soon.Recv(t, &err, attached, t.Fatalf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	t.Run("RTL6a: published messages are encoded and encrypted", func(t *testing.T) {
+		in, out, channel := setup(t)
+
+		data := map[string]interface{}{"foo": "bar"}
+		published := make(chan error, 1)
+		go func() {
+			published <- channel.Publish(context.Background(), "name", data)
+		}()
+
+		var msg *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+		if expected, got := ably.ActionMessage, msg.Action; expected != got {
+			t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+		}
+		if expected, got := "json/utf-8/cipher+aes-256-cbc/base64", msg.Messages[0].Encoding; expected != got {
+			t.Fatalf("expected encoding %q; got %q", expected, got)
+		}
+		decoded, err := ably.MessageWithDecodedData(*msg.Messages[0], cipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, decoded.Data) {
+			t.Fatalf("expected %#v; got %#v", data, decoded.Data)
+		}
+
+		in <- &ably.ProtocolMessage{
+			Action:    ably.ActionAck,
+			MsgSerial: msg.MsgSerial,
+			Count:     1,
+		}
+		ablytest.Soon.Recv(t, &err, published, t.Fatalf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("RTL7d: received messages are decrypted and decoded", func(t *testing.T) {
+		in, _, channel := setup(t)
+
+		msgs := make(messages, 1)
+		_, err := channel.SubscribeAll(context.Background(), msgs.Receive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := ably.MessageWithEncodedData(ably.Message{Name: "name", Data: []byte{0xca, 0xfe}}, cipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in <- &ably.ProtocolMessage{
+			Action:   ably.ActionMessage,
+			Channel:  channel.Name,
+			Messages: []*ably.Message{&encoded},
+		}
+
+		var msg *ably.Message
+		ablytest.Soon.Recv(t, &msg, msgs, t.Fatalf)
+		if expected, got := []byte{0xca, 0xfe}, msg.Data; !reflect.DeepEqual(expected, got) {
+			t.Fatalf("expected %#v; got %#v", expected, got)
+		}
+		if msg.Encoding != "" {
+			t.Fatalf("expected fully decoded message; got encoding %q", msg.Encoding)
+		}
+	})
+
+	t.Run("RTL7e: undecodable messages keep the residual encoding", func(t *testing.T) {
+		in, _, channel := setup(t)
+
+		msgs := make(messages, 1)
+		_, err := channel.SubscribeAll(context.Background(), msgs.Receive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		in <- &ably.ProtocolMessage{
+			Action:  ably.ActionMessage,
+			Channel: channel.Name,
+			Messages: []*ably.Message{{
+				Name:     "name",
+				Data:     "bm90IGEgY2lwaGVydGV4dA==",
+				Encoding: "utf-8/cipher+aes-256-cbc/base64",
+			}},
+		}
+
+		var msg *ably.Message
+		ablytest.Soon.Recv(t, &msg, msgs, t.Fatalf)
+		if expected, got := "utf-8/cipher+aes-256-cbc", msg.Encoding; expected != got {
+			t.Fatalf("expected encoding %q; got %q", expected, got)
+		}
+	})
+}
+
+func TestRealtimeChannel_RTL3c_SuspendedWithConnection(t *testing.T) {
+	t.Parallel()
+
+	var connID int32
+	var failDial int32
+	out := make(chan *ably.ProtocolMessage, 16)
+	ins := make(chan chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithConnectionStateTTL(time.Millisecond),
+		ably.WithDisconnectedRetryTimeout(10*time.Millisecond),
+		ably.WithSuspendedRetryTimeout(10*time.Millisecond),
+		ably.WithDial(func(proto string, u *url.URL, timeout time.Duration) (ably.Conn, error) {
+			if atomic.LoadInt32(&failDial) != 0 {
+				return nil, errors.New("can't reconnect")
+			}
+			in := make(chan *ably.ProtocolMessage, 1)
+			in <- &ably.ProtocolMessage{
+				Action:       ably.ActionConnected,
+				ConnectionID: fmt.Sprintf("connection-%d", atomic.AddInt32(&connID, 1)),
+				ConnectionDetails: &ably.ConnectionDetails{
+					ConnectionKey:      "key",
+					ConnectionStateTTL: ably.DurationFromMsecs(time.Millisecond),
+					MaxIdleInterval:    ably.DurationFromMsecs(time.Minute),
+				},
+			}
+			ins <- in
+			return MessagePipe(in, out)(proto, u, timeout)
+		}),
+	)
+	defer c.Close()
+
+	err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in chan *ably.ProtocolMessage
+	ablytest.Instantly.Recv(t, &in, ins, t.Fatalf)
+
+	channel := c.Channels.Get("test")
+	go channel.Attach(context.Background())
+	ablytest.Soon.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+		return channel.State() == ably.ChannelStateAttached
+	}), nil)
+
+	stateChanges := make(ably.ChannelStateChanges, 10)
+	channel.OnAll(stateChanges.Receive)
+
+	// Fail reconnections until the connection becomes SUSPENDED; the channel
+	// should follow.
+	atomic.StoreInt32(&failDial, 1)
+	close(in)
+
+	var change ably.ChannelStateChange
+	ablytest.Soon.Recv(t, &change, stateChanges, t.Fatalf)
+	if expected, got := ably.ChannelStateSuspended, change.Current; expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+	if change.Reason == nil {
+		t.Fatal("expected a reason for the channel becoming SUSPENDED")
+	}
+
+	// RTN15c3: once reconnected, the channel is reattached.
+	atomic.StoreInt32(&failDial, 0)
+
+	ablytest.Soon.Recv(t, &in, ins, t.Fatalf)
+	ablytest.Soon.Recv(t, &change, stateChanges, t.Fatalf)
+	if expected, got := ably.ChannelStateAttaching, change.Current; expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+	var msg *ably.ProtocolMessage
+	ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+	if expected, got := ably.ActionAttach, msg.Action; expected != got {
+		t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+	}
+
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Soon.Recv(t, &change, stateChanges, t.Fatalf)
+	if expected, got := ably.ChannelStateAttached, change.Current; expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+}
+
+func TestRealtimeChannel_RTL10b_HistoryUntilAttach(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	client := &http.Client{
+		Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests <- req
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader("[]")),
+			}, nil
+		}),
+	}
+
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithHTTPClient(client),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection-id",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("test")
+
+	_, err = channel.History(ably.HistoryWithUntilAttach()).Pages(context.Background())
+	if expected, got := ably.ErrChannelOperationFailedInvalidChannelState, ably.UnwrapErrorCode(err); expected != got {
+		t.Fatalf("expected error code %v when not attached; got %v (error: %v)", expected, got, err)
+	}
+	ablytest.Instantly.NoRecv(t, nil, requests, t.Fatalf)
+
+	go channel.Attach(context.Background())
+	ablytest.Instantly.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+	in <- &ably.ProtocolMessage{
+		Action:        ably.ActionAttached,
+		Channel:       channel.Name,
+		ChannelSerial: "attach-serial",
+	}
+	ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+		return channel.State() == ably.ChannelStateAttached
+	}), nil)
+
+	_, err = channel.History(ably.HistoryWithUntilAttach()).Pages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req *http.Request
+	ablytest.Instantly.Recv(t, &req, requests, t.Fatalf)
+	if expected, got := "attach-serial", req.URL.Query().Get("fromSerial"); expected != got {
+		t.Fatalf("expected fromSerial %q; got %q", expected, got)
+	}
+
+	// Not supported by REST channels.
+	rest, err := ably.NewREST(ably.WithKey("fake:key"), ably.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rest.Channels.Get("test").History(ably.HistoryWithUntilAttach()).Pages(context.Background())
+	if err == nil {
+		t.Fatal("expected error from untilAttach on a REST channel")
+	}
+	ablytest.Instantly.NoRecv(t, nil, requests, t.Fatalf)
+}
+
+func TestRealtimeChannel_RTL10_HistoryDecryption(t *testing.T) {
+	key, err := ably.Crypto.GenerateRandomKey(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := ably.NewCBCCipher(ably.Crypto.GetDefaultParams(ably.CipherParams{Key: key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := ably.MessageWithEncodedData(ably.Message{Name: "name", Data: "secret"}, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := json.Marshal([]ably.Message{encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{
+		Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(bytes.NewReader(history)),
+			}, nil
+		}),
+	}
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(client),
+	)
+	channel := c.Channels.Get("test", ably.ChannelWithCipherKey(key))
+
+	// Concurrent calls mustn't race on any shared channel's options.
+	errs := make(chan error, 2)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			items, err := channel.History().Items(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !items.Next(context.Background()) {
+				errs <- fmt.Errorf("expected a message; got error %v", items.Err())
+				return
+			}
+			if expected, got := "secret", items.Item().Data; expected != got {
+				errs <- fmt.Errorf("expected data %q; got %v", expected, got)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		ablytest.Soon.Recv(t, &err, errs, t.Fatalf)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRealtimeChannel_RTL16_SetOptions(t *testing.T) {
+	setup := func(t *testing.T) (in, out chan *ably.ProtocolMessage, c *ably.Realtime) {
+		in = make(chan *ably.ProtocolMessage, 1)
+		out = make(chan *ably.ProtocolMessage, 16)
+
+		c, _ = ably.NewRealtime(
+			ably.WithToken("fake:token"),
+			ably.WithAutoConnect(false),
+			ably.WithDial(MessagePipe(in, out)),
+		)
+
+		in <- &ably.ProtocolMessage{
+			Action:            ably.ActionConnected,
+			ConnectionID:      "connection-id",
+			ConnectionDetails: &ably.ConnectionDetails{},
+		}
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	attach := func(t *testing.T, in, out chan *ably.ProtocolMessage, channel *ably.RealtimeChannel) *ably.ProtocolMessage {
+		t.Helper()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- channel.Attach(context.Background())
+		}()
+		var msg *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+		in <- &ably.ProtocolMessage{
+			Action:  ably.ActionAttached,
+			Channel: channel.Name,
+		}
+		var err error
+		ablytest.Soon.Recv(t, &err, errs, t.Fatalf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	t.Run("RTL4k: typed params are sent on attach", func(t *testing.T) {
+		in, out, c := setup(t)
+		defer c.Close()
+
+		for _, tc := range []struct {
+			name     string
+			option   ably.ChannelOption
+			key      string
+			expected string
+		}{
+			{"rewind", ably.ChannelWithRewind(10), "rewind", "10"},
+			{"rewind seconds", ably.ChannelWithRewindDuration(90 * time.Second), "rewind", "90s"},
+			{"rewind minutes", ably.ChannelWithRewindDuration(2 * time.Minute), "rewind", "2m"},
+			{"rewind below a second", ably.ChannelWithRewindDuration(500 * time.Millisecond), "rewind", "1s"},
+			{"rewind zero", ably.ChannelWithRewindDuration(0), "rewind", "1s"},
+			{"occupancy", ably.ChannelWithOccupancy(), "occupancy", "metrics"},
+		} {
+			msg := attach(t, in, out, c.Channels.Get(tc.name, tc.option))
+			if expected, got := tc.expected, msg.Params[tc.key]; expected != got {
+				t.Errorf("%s: expected %q; got %q", tc.name, expected, got)
+			}
+		}
+	})
+
+	t.Run("RTL16a: reattaches when params change", func(t *testing.T) {
+		in, out, c := setup(t)
+		defer c.Close()
+
+		channel := c.Channels.Get("test")
+		attach(t, in, out, channel)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- channel.SetOptions(context.Background(), ably.ChannelWithRewind(1))
+		}()
+
+		var msg *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+		if expected, got := ably.ActionAttach, msg.Action; expected != got {
+			t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+		}
+		if expected, got := "1", msg.Params["rewind"]; expected != got {
+			t.Fatalf("expected rewind %q; got %q", expected, got)
+		}
+		ablytest.Instantly.NoRecv(t, nil, errs, t.Fatalf)
+
+		in <- &ably.ProtocolMessage{
+			Action:  ably.ActionAttached,
+			Channel: channel.Name,
+		}
+		var err error
+		ablytest.Soon.Recv(t, &err, errs, t.Fatalf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Same params: no reattach.
+		err = channel.SetOptions(context.Background(), ably.ChannelWithRewind(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
+	})
+
+	t.Run("RTS3c: Get with options on an existing channel reattaches", func(t *testing.T) {
+		in, out, c := setup(t)
+		defer c.Close()
+
+		channel := c.Channels.Get("test")
+		attach(t, in, out, channel)
+
+		if got := c.Channels.Get("test", ably.ChannelWithRewind(5)); got != channel {
+			t.Fatal("expected the existing channel")
+		}
+
+		var msg *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+		if expected, got := ably.ActionAttach, msg.Action; expected != got {
+			t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+		}
+		if expected, got := "5", msg.Params["rewind"]; expected != got {
+			t.Fatalf("expected rewind %q; got %q", expected, got)
+		}
+	})
+
+	t.Run("RTS3c: Get with options on an existing channel keeps the others", func(t *testing.T) {
+		in, out, c := setup(t)
+		defer c.Close()
+
+		key, err := ably.Crypto.GenerateRandomKey(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cipher, err := ably.NewCBCCipher(ably.Crypto.GetDefaultParams(ably.CipherParams{Key: key}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel := c.Channels.Get("test", ably.ChannelWithCipherKey(key), ably.ChannelWithOccupancy())
+		attach(t, in, out, channel)
+
+		c.Channels.Get("test", ably.ChannelWithRewind(5))
+
+		var msg *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+		if len(msg.Params) != 2 || msg.Params["occupancy"] != "metrics" || msg.Params["rewind"] != "5" {
+			t.Fatalf("expected both occupancy and rewind params; got %v", msg.Params)
+		}
+		in <- &ably.ProtocolMessage{
+			Action:  ably.ActionAttached,
+			Channel: channel.Name,
+		}
+
+		// Messages are still decrypted with the cipher set before.
+		msgs := make(messages, 1)
+		_, err = channel.SubscribeAll(context.Background(), msgs.Receive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := ably.MessageWithEncodedData(ably.Message{Name: "name", Data: "secret"}, cipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in <- &ably.ProtocolMessage{
+			Action:   ably.ActionMessage,
+			Channel:  channel.Name,
+			Messages: []*ably.Message{&encoded},
+		}
+		var m *ably.Message
+		ablytest.Soon.Recv(t, &m, msgs, t.Fatalf)
+		if expected, got := "secret", m.Data; expected != got {
+			t.Fatalf("expected data %q; got %v", expected, got)
+		}
+	})
+
+	t.Run("doesn't attach a detached channel", func(t *testing.T) {
+		_, out, c := setup(t)
+		defer c.Close()
+
+		channel := c.Channels.Get("test")
+		err := channel.SetOptions(context.Background(), ably.ChannelWithRewind(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
+	})
+}
+
+func TestRealtimeChannel_RTL19_RTL20_DeltaDecoding(t *testing.T) {
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection-id",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("test", ably.ChannelWithDelta())
+
+	go channel.Attach(context.Background())
+	var attach *ably.ProtocolMessage
+	ablytest.Instantly.Recv(t, &attach, out, t.Fatalf)
+	if expected, got := "vcdiff", attach.Params["delta"]; expected != got {
+		t.Fatalf("expected delta param %q; got %q", expected, got)
+	}
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+		return channel.State() == ably.ChannelStateAttached
+	}), nil)
+
+	msgs := make(chan *ably.Message, 2)
+	_, err = channel.SubscribeAll(context.Background(), func(m *ably.Message) {
+		msgs <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A delta from `{"a":1}` to `{"a":1,"b":2}`: COPY 6 bytes from the
+	// source, then ADD the rest.
+	added := `,"b":2}`
+	delta := []byte{0xd6, 0xc3, 0xc4, 0x00, 0x00, // header
+		0x01, 0x07, 0x00, // VCD_SOURCE, segment size and position
+		0x0f, 0x0d, 0x00, 0x07, 0x02, 0x01, // lengths
+	}
+	delta = append(delta, added...)
+	delta = append(delta, 22, 8, 0) // instructions and address
+	deltaData := base64.StdEncoding.EncodeToString(delta)
+
+	in <- &ably.ProtocolMessage{
+		Action:        ably.ActionMessage,
+		Channel:       channel.Name,
+		ID:            "msg",
+		ChannelSerial: "serial-1",
+		Messages: []*ably.Message{{
+			Data:     `{"a":1}`,
+			Encoding: "json",
+		}, {
+			Data:     deltaData,
+			Encoding: "json/vcdiff/base64",
+			Extras: map[string]interface{}{
+				"delta": map[string]interface{}{"from": "msg:0", "format": "vcdiff"},
+			},
+		}},
+	}
+
+	var m *ably.Message
+	ablytest.Instantly.Recv(t, &m, msgs, t.Fatalf)
+	if expected, got := (map[string]interface{}{"a": float64(1)}), m.Data; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected data %v; got %v", expected, got)
+	}
+	ablytest.Instantly.Recv(t, &m, msgs, t.Fatalf)
+	if expected, got := (map[string]interface{}{"a": float64(1), "b": float64(2)}), m.Data; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected data %v; got %v", expected, got)
+	}
+	if expected, got := "msg:1", m.ID; expected != got {
+		t.Fatalf("expected message ID %q; got %q", expected, got)
+	}
+
+	// RTL18: a delta from a message other than the last one received makes
+	// the channel reattach from the last processed message.
+	changes := make(ably.ChannelStateChanges, 1)
+	off := channel.OnAll(changes.Receive)
+	defer off()
+
+	in <- &ably.ProtocolMessage{
+		Action:        ably.ActionMessage,
+		Channel:       channel.Name,
+		ID:            "other",
+		ChannelSerial: "serial-2",
+		Messages: []*ably.Message{{
+			Data:     deltaData,
+			Encoding: "json/vcdiff/base64",
+			Extras: map[string]interface{}{
+				"delta": map[string]interface{}{"from": "msg:0", "format": "vcdiff"},
+			},
+		}},
+	}
+
+	var change ably.ChannelStateChange
+	ablytest.Instantly.Recv(t, &change, changes, t.Fatalf)
+	if expected, got := ably.ChannelStateAttaching, change.Current; expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+	if expected, got := ably.ErrorCode(40018), ably.UnwrapErrorCode(change.Reason); expected != got {
+		t.Fatalf("expected error code %v; got %v (error: %v)", expected, got, change.Reason)
+	}
+	ablytest.Instantly.NoRecv(t, nil, msgs, t.Fatalf)
+
+	ablytest.Instantly.Recv(t, &attach, out, t.Fatalf)
+	if expected, got := ably.ActionAttach, attach.Action; expected != got {
+		t.Fatalf("expected %v; got %v", expected, got)
+	}
+	if expected, got := "serial-1", attach.ChannelSerial; expected != got {
+		t.Fatalf("expected channel serial %q; got %q", expected, got)
+	}
+}
@@ -151,3 +151,121 @@ func TestRealtimeChannel_AttachWhileDisconnected(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRealtimeChannel_OnOccupancy(t *testing.T) {
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, err := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection-id",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	err = ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("room", ably.ChannelWithOccupancy())
+	occupancies := make(chan *ably.ChannelOccupancy, 1)
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := channel.OnOccupancy(context.Background(), func(o *ably.ChannelOccupancy) {
+			occupancies <- o
+		})
+		subscribed <- err
+	}()
+
+	var msg *ably.ProtocolMessage
+	ablytest.Instantly.Recv(t, &msg, out, t.Fatalf)
+	if expected, got := ably.ActionAttach, msg.Action; expected != got {
+		t.Fatalf("expected %v; got %v", expected, got)
+	}
+	if expected, got := "metrics", msg.Params["occupancy"]; expected != got {
+		t.Errorf("expected occupancy param %q; got %q", expected, got)
+	}
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Soon.Recv(t, &err, subscribed, t.Fatalf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionMessage,
+		Channel: channel.Name,
+		Messages: []*ably.Message{
+			{Name: "chat", Data: "hello"},
+			{
+				Name:     ably.MetaOccupancy,
+				Data:     `{"metrics":{"connections":3,"publishers":1,"subscribers":3,"presenceMembers":2}}`,
+				Encoding: "json",
+			},
+		},
+	}
+
+	var occupancy *ably.ChannelOccupancy
+	ablytest.Soon.Recv(t, &occupancy, occupancies, t.Fatalf)
+	expected := ably.ChannelMetrics{
+		Connections:     3,
+		Publishers:      1,
+		Subscribers:     3,
+		PresenceMembers: 2,
+	}
+	if got := occupancy.Metrics; expected != got {
+		t.Errorf("expected %+v; got %+v", expected, got)
+	}
+	ablytest.Instantly.NoRecv(t, nil, occupancies, t.Fatalf)
+}
+
+func TestDecodeLifecycleEvents(t *testing.T) {
+	// Data decoded from JSON.
+	channelEvent, err := ably.DecodeChannelLifecycleEvent(&ably.Message{
+		Name: ably.MetaChannelOpened,
+		Data: map[string]interface{}{
+			"channelId": "room",
+			"status": map[string]interface{}{
+				"isActive":  true,
+				"occupancy": map[string]interface{}{"metrics": map[string]interface{}{"connections": float64(1)}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := channelEvent; e.Name != ably.MetaChannelOpened || e.Channel.ChannelID != "room" ||
+		!e.Channel.Status.IsActive || e.Channel.Status.Occupancy.Metrics.Connections != 1 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	// Data decoded from MessagePack.
+	connEvent, err := ably.DecodeConnectionLifecycleEvent(&ably.Message{
+		Name: ably.MetaConnectionClosed,
+		Data: map[interface{}]interface{}{
+			"connectionId": "conn",
+			"clientId":     "alice",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := connEvent; e.Name != ably.MetaConnectionClosed || e.Connection.ConnectionID != "conn" || e.Connection.ClientID != "alice" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	if _, err := ably.DecodeOccupancy(&ably.Message{Name: "chat", Data: "{}"}); err == nil {
+		t.Errorf("expected error decoding occupancy from another message")
+	}
+}
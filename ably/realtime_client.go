@@ -66,8 +66,12 @@ func (c *Realtime) onChannelMsg(msg *protocolMessage) {
 func (c *Realtime) onReconnected(isNewID bool) {
 	if !isNewID /* RTN15c3, RTN15g3 */ {
 		// No need to reattach: state is preserved. We just need to flush the
-		// queue of pending messages.
+		// queue of pending messages, and reattach channels that were
+		// suspended while the connection was.
 		for _, ch := range c.Channels.Iterate() {
+			if ch.State() == ChannelStateSuspended {
+				ch.mayAttach(false)
+			}
 			ch.queue.Flush()
 		}
 		//RTN19a
@@ -77,8 +81,7 @@ func (c *Realtime) onReconnected(isNewID bool) {
 
 	for _, ch := range c.Channels.Iterate() {
 		switch ch.State() {
-		// TODO: SUSPENDED
-		case ChannelStateAttaching, ChannelStateAttached: //RTN19b
+		case ChannelStateAttaching, ChannelStateAttached, ChannelStateSuspended: //RTN19b, RTN15c3
 			ch.mayAttach(false)
 		case ChannelStateDetaching: //RTN19b
 			ch.detachSkipVerifyActive()
@@ -98,6 +101,10 @@ func isTokenError(err *errorInfo) bool {
 	return err != nil && err.StatusCode == http.StatusUnauthorized && (40140 <= err.Code && err.Code < 40150)
 }
 
+func isTokenRevokedError(err *errorInfo) bool {
+	return err != nil && err.Code == int(ErrTokenRevoked)
+}
+
 func (c *Realtime) opts() *clientOptions {
 	return c.rest.opts
 }
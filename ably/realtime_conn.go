@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ably/ably-go/ably/internal/ablyutil"
+	"github.com/ably/ably-go/ably/internal/websocket"
 )
 
 var (
@@ -65,6 +70,20 @@ type Connection struct {
 	// after a reauthorization, to avoid re-reauthorizing.
 	reauthorizing bool
 	arg           connArgs
+
+	// pings tracks the heartbeats sent by Ping, by ID, that are waiting for a
+	// response.
+	pings map[string]chan<- struct{}
+
+	// successFallbackHost caches the last fallback host we successfully
+	// connected to, so that it's tried first on reconnection (RTN17e).
+	successFallbackHost *fallbackCache
+	// websocketFailures counts consecutive failed websocket connection
+	// attempts, to decide when to fall back to Comet.
+	websocketFailures int
+
+	// cancelTokenRenewal cancels the token renewal scheduled while connected.
+	cancelTokenRenewal context.CancelFunc
 }
 
 type connCallbacks struct {
@@ -89,6 +108,10 @@ func newConn(opts *clientOptions, auth *Auth, callbacks connCallbacks) *Connecti
 		pending:   newPendingEmitter(auth.log()),
 		auth:      auth,
 		callbacks: callbacks,
+
+		successFallbackHost: &fallbackCache{
+			duration: opts.fallbackRetryTimeout(),
+		},
 	}
 	auth.onExplicitAuthorize = c.onClientAuthorize
 	c.queue = newMsgQueue(c)
@@ -115,7 +138,11 @@ func (c *Connection) dial(proto string, u *url.URL) (conn conn, err error) {
 	if c.opts.Dial != nil {
 		conn, err = c.opts.Dial(proto, u, timeout)
 	} else {
-		conn, err = dialWebsocket(proto, u, timeout)
+		transport := c.opts.Transport
+		if transport == nil {
+			transport = websocketTransport(c.opts)
+		}
+		conn, err = dialTransport(transport, proto, u, timeout)
 	}
 	if err != nil {
 		c.log().Debugf("Dial Failed in %v with %v", time.Since(start), err)
@@ -125,6 +152,70 @@ func (c *Connection) dial(proto string, u *url.URL) (conn conn, err error) {
 	return conn, err
 }
 
+func (c *Connection) dialHost(proto, host string, query url.Values) (conn, error) {
+	u, err := url.Parse(c.opts.realtimeURLForHost(host))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+	return c.dial(proto, u)
+}
+
+// dialFallbacks is called after dialing failedHost failed with err. If the
+// internet connection is up, it tries the primary host and the fallback
+// hosts, the latter in random order, until one of them succeeds (RTN17d).
+func (c *Connection) dialFallbacks(proto, failedHost string, query url.Values, err error) (conn, error) {
+	fallbacks, fallbacksErr := c.opts.getFallbackHosts()
+	if fallbacksErr != nil || len(fallbacks) == 0 {
+		return nil, err
+	}
+	// RTN17c
+	if !c.opts.hasActiveInternetConnection() {
+		c.log().Errorf("No internet connection; not trying fallback hosts")
+		return nil, err
+	}
+	hosts := []string{c.opts.getRealtimeHost()}
+	for _, i := range rand.Perm(len(fallbacks)) {
+		hosts = append(hosts, fallbacks[i])
+	}
+	for _, host := range hosts {
+		if host == failedHost {
+			continue
+		}
+		c.log().Infof("Trying fallback host %q", host)
+		conn, dialErr := c.dialHost(proto, host, query)
+		if dialErr == nil {
+			c.successFallbackHost.put(host)
+			return conn, nil
+		}
+		if !canFallBackRealtime(dialErr) {
+			return nil, dialErr
+		}
+		err = dialErr
+	}
+	c.log().Errorf("Exhausted fallback hosts")
+	return nil, err
+}
+
+// canFallBackRealtime returns true if err, from dialing a realtime host,
+// means the host is unreachable, timed out or failed with a server error
+// (RTN17d).
+func canFallBackRealtime(err error) bool {
+	var handshakeErr *websocket.HandshakeError
+	if errors.As(err, &handshakeErr) {
+		return canFallBack(handshakeErr.StatusCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var e *ErrorInfo
+	if errors.As(err, &e) {
+		return canFallBack(e.StatusCode)
+	}
+	return false
+}
+
 // recoverable returns true if err is recoverable, err is from making a
 // connection
 func recoverable(err error) bool {
@@ -347,10 +438,6 @@ func (c *Connection) connectWith(arg connArgs) (result, error) {
 		c.lockSetState(ConnectionStateConnecting, nil, 0)
 	}
 	c.mtx.Unlock()
-	u, err := url.Parse(c.opts.realtimeURL())
-	if err != nil {
-		return nil, err
-	}
 	var res result
 	if arg.result {
 		res = c.internalEmitter.listenResult(
@@ -363,15 +450,19 @@ func (c *Connection) connectWith(arg connArgs) (result, error) {
 	if err != nil {
 		return nil, err
 	}
-	u.RawQuery = query.Encode()
 	proto := c.opts.protocol()
 
 	if c.State() == ConnectionStateClosed { // RTN12d - if connection is closed by client, don't try to reconnect
 		return nopResult, nil
 	}
 
+	host := c.opts.getRealtimeHost()
+	if h := c.successFallbackHost.get(); h != "" {
+		host = h // RTN17e
+	}
+
 	// if err is nil, raw connection with server is successful
-	conn, err := c.dial(proto, u)
+	conn, err := c.dialRealtime(proto, host, query)
 	if err != nil {
 		return nil, err
 	}
@@ -446,15 +537,74 @@ func (c *Connection) Key() string {
 	return c.key
 }
 
-// Ping issues a ping request against configured endpoint and returns TTR times
-// for ping request and pong response.
+// Ping sends a heartbeat to Ably and waits for it to be echoed back,
+// returning the round-trip time (RTN13a, RTN13e).
 //
 // Ping returns non-nil error without any attempt of communication with Ably
-// if the connection state is ConnectionStateClosed or ConnectionStateFailed.
-// RTN13
-//func (c *Connection) Ping() (ping, pong time.Duration, err error) {
-//	return 0, 0, errors.New("TODO")
-//}
+// if the connection state isn't ConnectionStateConnected (RTN13b). It also
+// fails if the connection leaves that state, ctx is done or the realtime
+// request timeout passes before the heartbeat is echoed back (RTN13c).
+func (c *Connection) Ping(ctx context.Context) (time.Duration, error) {
+	id, err := ablyutil.BaseID()
+	if err != nil {
+		return 0, err
+	}
+
+	lost := make(chan ConnectionState, 1)
+	off := c.internalEmitter.OnAll(func(change ConnectionStateChange) {
+		if change.Current != ConnectionStateConnected {
+			select {
+			case lost <- change.Current:
+			default:
+			}
+		}
+	})
+	defer off()
+
+	pong := make(chan struct{})
+	c.mtx.Lock()
+	if state := c.state; state != ConnectionStateConnected {
+		c.mtx.Unlock()
+		return 0, connStateError(state, fmt.Errorf("cannot ping in connection state %v", state))
+	}
+	if c.pings == nil {
+		c.pings = make(map[string]chan<- struct{})
+	}
+	c.pings[id] = pong
+	start := c.opts.Now()
+	err = c.conn.Send(&protocolMessage{Action: actionHeartbeat, ID: id})
+	if err != nil {
+		// As in send, force a reconnection on transport-level failures.
+		c.conn.Close()
+	}
+	c.mtx.Unlock()
+
+	defer func() {
+		c.mtx.Lock()
+		delete(c.pings, id)
+		c.mtx.Unlock()
+	}()
+
+	if err != nil {
+		return 0, newError(ErrDisconnected, err)
+	}
+
+	// RTN13c
+	timeoutCtx, cancel := c.opts.contextWithTimeout(ctx, c.opts.realtimeRequestTimeout())
+	defer cancel()
+
+	select {
+	case <-pong:
+		return c.opts.Now().Sub(start), nil
+	case state := <-lost:
+		return 0, connStateError(state, fmt.Errorf("connection became %v before receiving the ping response", state))
+	case <-timeoutCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return 0, newError(ErrTimeoutError, errors.New("timed out before receiving the ping response"))
+	}
+}
 
 // ErrorReason gives last known error that caused connection transit to
 // ConnectionStateFailed state.
@@ -718,6 +868,12 @@ func (c *Connection) eventloop() {
 		}
 		switch msg.Action {
 		case actionHeartbeat:
+			c.mtx.Lock()
+			if pong, ok := c.pings[msg.ID]; ok { // RTN13e
+				close(pong)
+				delete(c.pings, msg.ID)
+			}
+			c.mtx.Unlock()
 		case actionAck:
 			c.mtx.Lock()
 			c.pending.Ack(msg, newErrorFromProto(msg.Error))
@@ -737,6 +893,13 @@ func (c *Connection) eventloop() {
 			reauthorizing := c.reauthorizing
 			c.reauthorizing = false
 			if isTokenError(msg.Error) {
+				if reauthorizing && isTokenRevokedError(msg.Error) {
+					// The revocation applies to the new token too, so
+					// reauthorizing again would only loop.
+					c.mtx.Unlock()
+					c.failedConnSideEffects(msg.Error)
+					return
+				}
 				if reauthorizing {
 					c.lockedReauthorizationFailed(newErrorFromProto(msg.Error))
 					c.mtx.Unlock()
@@ -748,7 +911,7 @@ func (c *Connection) eventloop() {
 					lastActivityAt: lastActivityAt,
 					connDetails:    connDetails,
 					dialOnce:       true,
-				})
+				}, msg.Error)
 				return
 			}
 			c.mtx.Unlock()
@@ -832,7 +995,7 @@ func (c *Connection) eventloop() {
 			c.reauthorize(connArgs{
 				lastActivityAt: lastActivityAt,
 				connDetails:    connDetails,
-			})
+			}, msg.Error)
 			return
 		case actionClosed:
 			c.mtx.Lock()
@@ -862,15 +1025,29 @@ func (c *Connection) failedConnSideEffects(err *errorInfo) {
 	}
 }
 
-func (c *Connection) reauthorize(arg connArgs) {
+// reauthorize gets a new token after Ably rejected the current one with the
+// given token error, and reconnects with it.
+func (c *Connection) reauthorize(arg connArgs, reason *errorInfo) {
 	c.mtx.Lock()
-	_, err := c.auth.reauthorize(context.Background())
+	var revoked string
+	if isTokenRevokedError(reason) {
+		revoked = c.auth.currentToken()
+	}
+	token, err := c.auth.reauthorize(context.Background())
 
 	if err != nil {
 		c.lockedReauthorizationFailed(err)
 		c.mtx.Unlock()
 		return
 	}
+	if revoked != "" && token.Token == revoked {
+		// Unlike an expired token, a revoked one may be handed out again,
+		// e.g. from a cache behind the AuthCallback. Reconnecting with it
+		// would only get it rejected again, in a loop.
+		c.mtx.Unlock()
+		c.failedConnSideEffects(reason)
+		return
+	}
 
 	// The reauthorize above will have set the new token in c.auth, so
 	// reconnecting will use the new token.
@@ -934,6 +1111,56 @@ func (vc verboseConn) Close() error {
 	return vc.conn.Close()
 }
 
+// lockScheduleTokenRenewal schedules the renewal of the current token before
+// it expires, replacing any renewal scheduled before. The renewed token is
+// sent to Ably in-band, so that the connection isn't interrupted.
+func (c *Connection) lockScheduleTokenRenewal() {
+	c.lockCancelTokenRenewal()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancelTokenRenewal = cancel
+	go c.renewToken(ctx)
+}
+
+func (c *Connection) lockCancelTokenRenewal() {
+	if c.cancelTokenRenewal != nil {
+		c.cancelTokenRenewal()
+		c.cancelTokenRenewal = nil
+	}
+}
+
+func (c *Connection) renewToken(ctx context.Context) {
+	// The delay is got here rather than when scheduling, as Auth is locked
+	// while it requests tokens, which c.mtx mustn't wait for.
+	delay, ok := c.auth.tokenRenewalDelay()
+	if !ok || delay <= 0 {
+		// The token was due for renewal already when it was used to
+		// connect, so renewing it right away would likely keep renewing it
+		// in a loop. If Ably rejects it, the connection is reauthorized
+		// then.
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case <-c.opts.After(ctx, delay):
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	c.log().Info("Renewing token before it expires")
+
+	// The renewal may be shared with a reauthorization on reconnection, so
+	// it mustn't be canceled along with the scheduled renewal.
+	authCtx, cancel := context.WithTimeout(context.Background(), c.opts.realtimeRequestTimeout())
+	defer cancel()
+	token, err := c.auth.reauthorize(authCtx)
+	if err != nil {
+		c.log().Errorf("Failed to renew token: %v", err)
+		return
+	}
+	c.onClientAuthorize(ctx, token)
+}
+
 func (c *Connection) setState(state ConnectionState, err error, retryIn time.Duration) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
@@ -948,6 +1175,11 @@ func (c *Connection) lockSetState(state ConnectionState, err error, retryIn time
 	previous := c.state
 	changed := c.state != state
 	c.state = state
+	if state == ConnectionStateConnected {
+		c.lockScheduleTokenRenewal()
+	} else {
+		c.lockCancelTokenRenewal()
+	}
 	c.errorReason = connStateError(state, err)
 	change := ConnectionStateChange{
 		Current:  c.state,
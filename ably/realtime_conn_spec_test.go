@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -14,6 +16,7 @@ import (
 	"time"
 
 	"github.com/ably/ably-go/ably"
+	"github.com/ably/ably-go/ably/internal/websocket"
 	"github.com/ably/ably-go/ablytest"
 )
 
@@ -2156,7 +2159,7 @@ func TestRealtimeConn_RTN15h2_ReauthWithBadToken(t *testing.T) {
 
 	tokenErr := ably.ProtoErrorInfo{
 		StatusCode: 401,
-		Code:       40141,
+		Code:       40142,
 		Message:    "fake token error",
 	}
 
@@ -3675,3 +3678,322 @@ func testConcurrentPublisher(t *testing.T, ch *ably.RealtimeChannel, out <-chan
 
 	return
 }
+
+func TestRealtimeConn_RTN17_FallbackHosts(t *testing.T) {
+	t.Parallel()
+
+	setup := func(internetUp bool, dialErr error) (*ably.Realtime, chan string, chan chan *ably.ProtocolMessage) {
+		dials := make(chan string, 16)
+		conns := make(chan chan *ably.ProtocolMessage, 16)
+		client := &http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if !internetUp {
+					return nil, errors.New("no internet")
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(strings.NewReader("yes")),
+				}, nil
+			}),
+		}
+		c, _ := ably.NewRealtime(
+			ably.WithAutoConnect(false),
+			ably.WithToken("fake:token"),
+			ably.WithHTTPClient(client),
+			ably.WithFallbackHosts([]string{"fallback-a", "fallback-b"}),
+			ably.WithDial(func(proto string, u *url.URL, timeout time.Duration) (ably.Conn, error) {
+				dials <- u.Hostname()
+				if u.Hostname() != "fallback-b" {
+					return nil, dialErr
+				}
+				in := make(chan *ably.ProtocolMessage, 1)
+				in <- &ably.ProtocolMessage{
+					Action:            ably.ActionConnected,
+					ConnectionID:      "connection",
+					ConnectionDetails: &ably.ConnectionDetails{},
+				}
+				conns <- in
+				return MessagePipe(in, make(chan *ably.ProtocolMessage, 16))(proto, u, timeout)
+			}))
+		return c, dials, conns
+	}
+
+	t.Run("RTN17d: tries fallback hosts when the primary host is unreachable", func(t *testing.T) {
+		t.Parallel()
+
+		c, dials, conns := setup(true, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+		defer c.Close()
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var host string
+		ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+		if expected, got := "realtime.ably.io", host; expected != got {
+			t.Fatalf("expected first dial to %q, got %q", expected, got)
+		}
+		for host != "fallback-b" {
+			ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+		}
+		ablytest.Instantly.NoRecv(t, nil, dials, t.Fatalf)
+
+		// RTN17e: the successful fallback host is tried first from now on.
+		var in chan *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &in, conns, t.Fatalf)
+
+		connected := make(ably.ConnStateChanges, 1)
+		off := c.Connection.Once(ably.ConnectionEventConnected, connected.Receive)
+		defer off()
+
+		close(in) // Simulate a transport failure, to reconnect.
+
+		ablytest.Soon.Recv(t, nil, connected, t.Fatalf)
+		ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+		if expected, got := "fallback-b", host; expected != got {
+			t.Fatalf("expected dial to cached fallback host %q, got %q", expected, got)
+		}
+		ablytest.Instantly.NoRecv(t, nil, dials, t.Fatalf)
+	})
+
+	t.Run("RTN17c: doesn't try fallback hosts without an internet connection", func(t *testing.T) {
+		t.Parallel()
+
+		c, dials, _ := setup(false, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+		defer c.Close()
+
+		change := make(ably.ConnStateChanges, 1)
+		off := c.Connection.On(ably.ConnectionEventDisconnected, change.Receive)
+		defer off()
+
+		c.Connect()
+
+		ablytest.Soon.Recv(t, nil, change, t.Fatalf)
+
+		var host string
+		ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+		if expected, got := "realtime.ably.io", host; expected != got {
+			t.Fatalf("expected dial to %q, got %q", expected, got)
+		}
+		ablytest.Instantly.NoRecv(t, nil, dials, t.Fatalf)
+	})
+
+	for _, c := range []struct {
+		status   int
+		fallback bool
+	}{
+		{http.StatusServiceUnavailable, true},
+		{http.StatusForbidden, false},
+	} {
+		c := c
+		t.Run(fmt.Sprintf("RTN17d: websocket handshake failing with status %d", c.status), func(t *testing.T) {
+			t.Parallel()
+
+			client, dials, _ := setup(true, &websocket.HandshakeError{
+				StatusCode: c.status,
+				Status:     http.StatusText(c.status),
+			})
+			defer client.Close()
+
+			change := make(ably.ConnStateChanges, 1)
+			off := client.Connection.On(ably.ConnectionEventConnected, change.Receive)
+			defer off()
+			off = client.Connection.On(ably.ConnectionEventDisconnected, change.Receive)
+			defer off()
+
+			client.Connect()
+
+			var state ably.ConnectionStateChange
+			ablytest.Soon.Recv(t, &state, change, t.Fatalf)
+			if c.fallback != (state.Current == ably.ConnectionStateConnected) {
+				t.Fatalf("unexpected state change %+v", state)
+			}
+
+			var host string
+			ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+			if expected, got := "realtime.ably.io", host; expected != got {
+				t.Fatalf("expected first dial to %q, got %q", expected, got)
+			}
+			if c.fallback {
+				ablytest.Instantly.Recv(t, &host, dials, t.Fatalf)
+			} else {
+				ablytest.Instantly.NoRecv(t, nil, dials, t.Fatalf)
+			}
+		})
+	}
+}
+
+func TestRealtimeConn_RTN13_Ping(t *testing.T) {
+	t.Parallel()
+
+	setup := func() (*ably.Realtime, chan *ably.ProtocolMessage, chan *ably.ProtocolMessage) {
+		in := make(chan *ably.ProtocolMessage, 1)
+		out := make(chan *ably.ProtocolMessage, 16)
+		in <- &ably.ProtocolMessage{
+			Action:            ably.ActionConnected,
+			ConnectionID:      "connection",
+			ConnectionDetails: &ably.ConnectionDetails{},
+		}
+		c, _ := ably.NewRealtime(
+			ably.WithAutoConnect(false),
+			ably.WithToken("fake:token"),
+			ably.WithDial(MessagePipe(in, out)))
+		return c, in, out
+	}
+
+	t.Run("RTN13b: fails if not connected", func(t *testing.T) {
+		t.Parallel()
+
+		c, _, out := setup()
+		defer c.Close()
+
+		_, err := c.Connection.Ping(context.Background())
+		if err == nil {
+			t.Fatal("expected error from Ping when not connected")
+		}
+		ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
+	})
+
+	t.Run("RTN13e: sends heartbeat with ID and waits for response", func(t *testing.T) {
+		t.Parallel()
+
+		c, in, out := setup()
+		defer c.Close()
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		type result struct {
+			d   time.Duration
+			err error
+		}
+		results := make(chan result, 1)
+		go func() {
+			d, err := c.Connection.Ping(context.Background())
+			results <- result{d, err}
+		}()
+
+		var heartbeat *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &heartbeat, out, t.Fatalf)
+		if expected, got := ably.ActionHeartbeat, heartbeat.Action; expected != got {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		if heartbeat.ID == "" {
+			t.Fatal("expected heartbeat to have an ID")
+		}
+
+		// Heartbeats with other IDs don't count as a response.
+		in <- &ably.ProtocolMessage{Action: ably.ActionHeartbeat}
+		in <- &ably.ProtocolMessage{Action: ably.ActionHeartbeat, ID: "other"}
+		ablytest.Instantly.NoRecv(t, nil, results, t.Fatalf)
+
+		in <- &ably.ProtocolMessage{Action: ably.ActionHeartbeat, ID: heartbeat.ID}
+
+		var res result
+		ablytest.Instantly.Recv(t, &res, results, t.Fatalf)
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.d < 0 {
+			t.Fatalf("expected non-negative round-trip time, got %v", res.d)
+		}
+	})
+
+	t.Run("fails if the connection is lost before the response", func(t *testing.T) {
+		t.Parallel()
+
+		c, in, out := setup()
+		defer c.Close()
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := c.Connection.Ping(context.Background())
+			errs <- err
+		}()
+
+		ablytest.Instantly.Recv(t, nil, out, t.Fatalf)
+
+		in <- nil // Simulate a transport failure.
+
+		var err2 error
+		ablytest.Soon.Recv(t, &err2, errs, t.Fatalf)
+		if err2 == nil {
+			t.Fatal("expected error from Ping after losing the connection")
+		}
+	})
+
+	t.Run("fails when the context is done", func(t *testing.T) {
+		t.Parallel()
+
+		c, _, out := setup()
+		defer c.Close()
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			_, err := c.Connection.Ping(ctx)
+			errs <- err
+		}()
+
+		ablytest.Instantly.Recv(t, nil, out, t.Fatalf)
+		cancel()
+
+		var err2 error
+		ablytest.Instantly.Recv(t, &err2, errs, t.Fatalf)
+		if !errors.Is(err2, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err2)
+		}
+	})
+	t.Run("RTN13c: fails if the response doesn't arrive in time", func(t *testing.T) {
+		t.Parallel()
+
+		in := make(chan *ably.ProtocolMessage, 1)
+		out := make(chan *ably.ProtocolMessage, 16)
+		in <- &ably.ProtocolMessage{
+			Action:       ably.ActionConnected,
+			ConnectionID: "connection",
+			// So that the connection isn't dropped for being idle first.
+			ConnectionDetails: &ably.ConnectionDetails{
+				MaxIdleInterval: ably.DurationFromMsecs(time.Minute),
+			},
+		}
+		c, _ := ably.NewRealtime(
+			ably.WithAutoConnect(false),
+			ably.WithToken("fake:token"),
+			ably.WithRealtimeRequestTimeout(10*time.Millisecond),
+			ably.WithDial(MessagePipe(in, out)))
+		defer c.Close()
+
+		err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := c.Connection.Ping(context.Background())
+			errs <- err
+		}()
+
+		// The heartbeat is never echoed back.
+		ablytest.Instantly.Recv(t, nil, out, t.Fatalf)
+
+		ablytest.Soon.Recv(t, &err, errs, t.Fatalf)
+		if expected, got := ably.ErrTimeoutError, ably.UnwrapErrorCode(err); expected != got {
+			t.Fatalf("expected error code %v; got %v (error: %v)", expected, got, err)
+		}
+	})
+}
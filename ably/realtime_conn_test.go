@@ -2,8 +2,15 @@ package ably_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -302,3 +309,516 @@ func TestRealtimeConn_SendErrorReconnects(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+type frameConn struct {
+	in  <-chan []byte
+	out chan<- []byte
+}
+
+func (c frameConn) Send(frame []byte) error {
+	c.out <- frame
+	return nil
+}
+
+func (c frameConn) Receive(deadline time.Time) ([]byte, error) {
+	frame, ok := <-c.in
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func (c frameConn) Close() error {
+	return nil
+}
+
+func TestRealtimeConn_Transport(t *testing.T) {
+	in := make(chan []byte, 1)
+	out := make(chan []byte, 16)
+
+	dialed := make(chan string, 1)
+	transport := ably.TransportFunc(func(protocol string, u *url.URL, timeout time.Duration) (ably.TransportConn, error) {
+		dialed <- protocol
+		return frameConn{in: in, out: out}, nil
+	})
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithTransport(transport),
+	)
+
+	in <- []byte(`{"action":4,"connectionId":"connection-id","connectionDetails":{}}`)
+	if err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil); err != nil {
+		t.Fatal(err)
+	}
+	var protocol string
+	ablytest.Instantly.Recv(t, &protocol, dialed, t.Fatalf)
+	if expected, got := "application/json", protocol; expected != got {
+		t.Fatalf("expected protocol %q; got %q", expected, got)
+	}
+	if expected, got := "connection-id", c.Connection.ID(); expected != got {
+		t.Fatalf("expected connection ID %q; got %q", expected, got)
+	}
+
+	go c.Channels.Get("test").Attach(context.Background())
+
+	var frame []byte
+	ablytest.Instantly.Recv(t, &frame, out, t.Fatalf)
+	var msg map[string]interface{}
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		t.Fatalf("expected a JSON-encoded frame; got %q (error: %v)", frame, err)
+	}
+	if expected, got := float64(ably.ActionAttach), msg["action"]; expected != got {
+		t.Fatalf("expected action %v; got %v", expected, got)
+	}
+	if expected, got := "test", msg["channel"]; expected != got {
+		t.Fatalf("expected channel %q; got %v", expected, got)
+	}
+}
+
+func TestRealtimeConn_Comet(t *testing.T) {
+	for _, c := range []struct {
+		name               string
+		mode               ably.CometMode
+		expectedWebsockets int32
+	}{
+		{"falls back after websocket failures", ably.CometModeFallback, 2},
+		{"forced", ably.CometModeForced, 0},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var websockets int32
+			connectQuery := make(chan url.Values, 1)
+			toClient := make(chan string, 16)
+			fromClient := make(chan map[string]interface{}, 16)
+			done := make(chan struct{})
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				// Like a proxy that doesn't allow websocket upgrades.
+				atomic.AddInt32(&websockets, 1)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			})
+			mux.HandleFunc("/comet/connect", func(w http.ResponseWriter, r *http.Request) {
+				connectQuery <- r.URL.Query()
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `[{"action":4,"connectionId":"connection-id","connectionDetails":{"connectionKey":"connection-key"}}]`)
+			})
+			mux.HandleFunc("/comet/connection-key/recv", func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case frame := <-toClient:
+					w.Header().Set("Content-Type", "application/json")
+					io.WriteString(w, frame)
+				case <-r.Context().Done():
+				case <-done:
+				}
+			})
+			mux.HandleFunc("/comet/connection-key/send", func(w http.ResponseWriter, r *http.Request) {
+				var msgs []map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				for _, m := range msgs {
+					fromClient <- m
+				}
+				// Like Ably, respond with some messages right away.
+				if len(msgs) == 1 && msgs[0]["action"] == float64(ably.ActionAttach) {
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `[{"action":11,"channel":%q}]`, msgs[0]["channel"])
+				}
+			})
+			mux.HandleFunc("/comet/connection-key/close", func(w http.ResponseWriter, r *http.Request) {})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			defer close(done)
+
+			client, err := ably.NewRealtime(
+				ably.WithToken("fake:token"),
+				ably.WithAutoConnect(false),
+				ably.WithRealtimeHost(srv.Listener.Addr().String()),
+				ably.WithTLS(false),
+				ably.WithUseBinaryProtocol(false),
+				ably.WithDisconnectedRetryTimeout(time.Millisecond),
+				ably.WithCometMode(c.mode),
+				// Shorter than recv long polls, which must not time out.
+				ably.WithHTTPRequestTimeout(100*time.Millisecond),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Connect()
+			ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+				return client.Connection.State() == ably.ConnectionStateConnected
+			}), nil)
+			if expected, got := c.expectedWebsockets, atomic.LoadInt32(&websockets); expected != got {
+				t.Fatalf("expected %d websocket attempts; got %d", expected, got)
+			}
+
+			var query url.Values
+			ablytest.Instantly.Recv(t, &query, connectQuery, t.Fatalf)
+			if expected, got := "fake:token", query.Get("access_token"); expected != got {
+				t.Fatalf("expected access_token %q; got %q", expected, got)
+			}
+			if expected, got := "false", query.Get("stream"); expected != got {
+				t.Fatalf("expected stream %q; got %q", expected, got)
+			}
+
+			channel := client.Channels.Get("test")
+			attached := make(chan error, 1)
+			go func() {
+				attached <- channel.Attach(context.Background())
+			}()
+			var msg map[string]interface{}
+			ablytest.Soon.Recv(t, &msg, fromClient, t.Fatalf)
+			if expected, got := float64(ably.ActionAttach), msg["action"]; expected != got {
+				t.Fatalf("expected action %v; got %v", expected, got)
+			}
+			ablytest.Soon.Recv(t, &err, attached, t.Fatalf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msgs := make(chan *ably.Message, 1)
+			_, err = channel.SubscribeAll(context.Background(), func(m *ably.Message) {
+				msgs <- m
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			disconnected := make(ably.ConnStateChanges, 1)
+			off := client.Connection.On(ably.ConnectionEventDisconnected, disconnected.Receive)
+			time.Sleep(300 * time.Millisecond)
+			off()
+			ablytest.Instantly.NoRecv(t, nil, disconnected, t.Fatalf)
+
+			toClient <- `[{"action":15,"channel":"test","messages":[{"name":"greeting","data":"hello"}]}]`
+			var m *ably.Message
+			ablytest.Soon.Recv(t, &m, msgs, t.Fatalf)
+			if expected, got := "hello", m.Data; expected != got {
+				t.Fatalf("expected data %q; got %v", expected, got)
+			}
+
+			client.Close()
+			ablytest.Soon.Recv(t, &msg, fromClient, t.Fatalf)
+			if expected, got := float64(ably.ActionClose), msg["action"]; expected != got {
+				t.Fatalf("expected action %v; got %v", expected, got)
+			}
+			toClient <- `[{"action":8}]`
+			ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+				return client.Connection.State() == ably.ConnectionStateClosed
+			}), nil)
+		})
+	}
+}
+
+func TestRealtimeConn_WebsocketProxyAndCloseCode(t *testing.T) {
+	var connections int32
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := acceptWebsocket(t, w, r)
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		writeWebsocketText(conn, `{"action":4,"connectionId":"connection-id","connectionDetails":{}}`)
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Close frame with code 4000.
+			reason := "going away for a bit"
+			conn.Write(append([]byte{0x88, byte(2 + len(reason)), 0x0f, 0xa0}, reason...))
+		}
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	connects := make(chan string, 2)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects <- r.Host
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	c, err := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithRealtimeHost(srv.Listener.Addr().String()),
+		ably.WithTLS(false),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithProxy(http.ProxyURL(proxyURL)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	disconnected := make(ably.ConnStateChanges, 1)
+	off := c.Connection.On(ably.ConnectionEventDisconnected, disconnected.Receive)
+	defer off()
+
+	c.Connect()
+
+	var host string
+	ablytest.Soon.Recv(t, &host, connects, t.Fatalf)
+	if expected, got := srv.Listener.Addr().String(), host; expected != got {
+		t.Fatalf("expected proxy CONNECT to %q; got %q", expected, got)
+	}
+
+	var change ably.ConnectionStateChange
+	ablytest.Soon.Recv(t, &change, disconnected, t.Fatalf)
+	var closeErr *ably.WebsocketCloseError
+	if !errors.As(change.Reason, &closeErr) {
+		t.Fatalf("expected a websocket close error as the reason; got %v", change.Reason)
+	}
+	if expected, got := 4000, closeErr.Code; expected != got {
+		t.Fatalf("expected close code %d; got %d", expected, got)
+	}
+	if expected, got := "going away for a bit", closeErr.Reason; expected != got {
+		t.Fatalf("expected close reason %q; got %q", expected, got)
+	}
+}
+
+func TestRealtimeConn_TokenRenewal(t *testing.T) {
+	afterCalls := make(chan ablytest.AfterCall, 1)
+	now, after := ablytest.TimeFuncs(afterCalls)
+
+	var calls int32
+	authCallback := func(ctx context.Context, params ably.TokenParams) (ably.Tokener, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return &ably.TokenDetails{
+			Token:   fmt.Sprintf("token-%d", n),
+			Issued:  now().UnixNano() / int64(time.Millisecond),
+			Expires: now().Add(time.Hour).UnixNano() / int64(time.Millisecond),
+		}, nil
+	}
+
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	c, err := ably.NewRealtime(
+		ably.WithAutoConnect(false),
+		ably.WithAuthCallback(authCallback),
+		ably.WithTokenRenewalMargin(time.Minute),
+		ably.WithNow(now),
+		ably.WithAfter(after),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expect the renewal to be scheduled the margin before the token
+	// expires.
+	var timer ablytest.AfterCall
+	ablytest.Soon.Recv(t, &timer, afterCalls, t.Fatalf)
+	if expected, got := 59*time.Minute, timer.D.Round(time.Second); expected != got {
+		t.Fatalf("expected renewal in %v; got %v", expected, got)
+	}
+	timer.Fire()
+
+	// The renewed token is sent in-band, without reconnecting.
+	var msg *ably.ProtocolMessage
+	ablytest.Soon.Recv(t, &msg, out, t.Fatalf)
+	if expected, got := ably.ActionAuth, msg.Action; expected != got {
+		t.Fatalf("expected %v; got %v", expected, got)
+	}
+	if expected, got := "token-2", msg.Auth.AccessToken; expected != got {
+		t.Fatalf("expected access token %q; got %q", expected, got)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 AuthCallback calls; got %d", got)
+	}
+
+	// Once Ably accepts the token, the next renewal is scheduled.
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	ablytest.Soon.Recv(t, &timer, afterCalls, t.Fatalf)
+	if expected, got := 59*time.Minute, timer.D.Round(time.Second); expected != got {
+		t.Fatalf("expected renewal in %v; got %v", expected, got)
+	}
+
+	// Closing the connection cancels the scheduled renewal.
+	c.Close()
+	ablytest.Soon.Recv(t, &msg, out, t.Fatalf)
+	if expected, got := ably.ActionClose, msg.Action; expected != got {
+		t.Fatalf("expected %v; got %v", expected, got)
+	}
+	in <- &ably.ProtocolMessage{Action: ably.ActionClosed}
+	ablytest.Soon.Recv(t, nil, timer.Ctx.Done(), t.Fatalf)
+}
+
+func TestRealtimeConn_TokenRevoked(t *testing.T) {
+	revoked := &ably.ProtoErrorInfo{
+		StatusCode: 401,
+		Code:       int(ably.ErrTokenRevoked),
+		Message:    "token revoked",
+	}
+	connected := &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+
+	setup := func(token func(n int32) string, reply func(dial int32) *ably.ProtocolMessage) (*ably.Realtime, *int32, chan chan *ably.ProtocolMessage) {
+		var calls, dials int32
+		conns := make(chan chan *ably.ProtocolMessage, 4)
+		c, err := ably.NewRealtime(
+			ably.WithAutoConnect(false),
+			ably.WithAuthCallback(func(context.Context, ably.TokenParams) (ably.Tokener, error) {
+				return ably.TokenString(token(atomic.AddInt32(&calls, 1))), nil
+			}),
+			ably.WithDial(func(proto string, u *url.URL, timeout time.Duration) (ably.Conn, error) {
+				in := make(chan *ably.ProtocolMessage, 1)
+				in <- reply(atomic.AddInt32(&dials, 1))
+				conns <- in
+				return MessagePipe(in, make(chan *ably.ProtocolMessage, 16))(proto, u, timeout)
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, &calls, conns
+	}
+
+	expectFailed := func(t *testing.T, c *ably.Realtime) {
+		t.Helper()
+		err := ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+			return c.Connection.State() == ably.ConnectionStateFailed
+		}), nil)
+		if err != nil {
+			t.Fatalf("expected FAILED; got %v", c.Connection.State())
+		}
+		if expected, got := ably.ErrTokenRevoked, c.Connection.ErrorReason().Code; expected != got {
+			t.Fatalf("expected error code %d; got %d", expected, got)
+		}
+	}
+
+	t.Run("fails if reauthorizing returns the revoked token", func(t *testing.T) {
+		c, calls, conns := setup(
+			func(int32) string { return "cached" },
+			func(int32) *ably.ProtocolMessage { return connected },
+		)
+		defer c.Close()
+
+		if err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil); err != nil {
+			t.Fatal(err)
+		}
+		var in chan *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &in, conns, t.Fatalf)
+		in <- &ably.ProtocolMessage{Action: ably.ActionDisconnected, Error: revoked}
+
+		expectFailed(t, c)
+		if expected, got := int32(2), atomic.LoadInt32(calls); expected != got {
+			t.Errorf("expected %d AuthCallback calls; got %d", expected, got)
+		}
+		ablytest.Instantly.NoRecv(t, nil, conns, t.Fatalf)
+	})
+
+	t.Run("fails if the new token is revoked too", func(t *testing.T) {
+		c, calls, conns := setup(
+			func(n int32) string { return fmt.Sprintf("token-%d", n) },
+			func(dial int32) *ably.ProtocolMessage {
+				if dial == 1 {
+					return connected
+				}
+				return &ably.ProtocolMessage{Action: ably.ActionError, Error: revoked}
+			},
+		)
+		defer c.Close()
+
+		if err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil); err != nil {
+			t.Fatal(err)
+		}
+		var in chan *ably.ProtocolMessage
+		ablytest.Instantly.Recv(t, &in, conns, t.Fatalf)
+		in <- &ably.ProtocolMessage{Action: ably.ActionDisconnected, Error: revoked}
+
+		// The client reconnects once with a new token.
+		ablytest.Soon.Recv(t, nil, conns, t.Fatalf)
+		expectFailed(t, c)
+		if expected, got := int32(2), atomic.LoadInt32(calls); expected != got {
+			t.Errorf("expected %d AuthCallback calls; got %d", expected, got)
+		}
+		ablytest.Instantly.NoRecv(t, nil, conns, t.Fatalf)
+	})
+}
+
+func TestRealtimeConn_TokenRenewalWhileAuthorizing(t *testing.T) {
+	authorizing := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	var calls int32
+	authCallback := func(ctx context.Context, params ably.TokenParams) (ably.Tokener, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			authorizing <- struct{}{}
+			<-unblock
+		}
+		return &ably.TokenDetails{
+			Token:   "token",
+			Expires: time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond),
+		}, nil
+	}
+
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	c, err := ably.NewRealtime(
+		ably.WithAutoConnect(false),
+		ably.WithAuthCallback(authCallback),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer close(unblock)
+
+	if err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	go c.Auth.Authorize(context.Background(), nil)
+	ablytest.Soon.Recv(t, nil, authorizing, t.Fatalf)
+
+	// Scheduling the next renewal on CONNECTED mustn't wait for the token
+	// request in flight. The message has no connection details, as updating
+	// the client ID from them still waits for it.
+	updated := make(ably.ConnStateChanges, 1)
+	off := c.Connection.On(ably.ConnectionEventUpdate, updated.Receive)
+	defer off()
+	in <- &ably.ProtocolMessage{
+		Action:       ably.ActionConnected,
+		ConnectionID: "connection",
+	}
+	ablytest.Soon.Recv(t, nil, updated, t.Fatalf)
+}
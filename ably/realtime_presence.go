@@ -29,6 +29,11 @@ type RealtimePresence struct {
 	state          PresenceAction
 	syncMtx        sync.Mutex
 	syncState      syncState
+
+	// internalMembers holds the members entered by this connection, keyed
+	// like members by connection ID and client ID, to re-enter them if
+	// presence state is lost (RTP17).
+	internalMembers map[string]*PresenceMessage
 }
 
 func newRealtimePresence(channel *RealtimeChannel) *RealtimePresence {
@@ -37,6 +42,8 @@ func newRealtimePresence(channel *RealtimeChannel) *RealtimePresence {
 		channel:        channel,
 		members:        make(map[string]*PresenceMessage),
 		syncState:      syncInitial,
+
+		internalMembers: make(map[string]*PresenceMessage),
 	}
 	// Lock syncMtx to make all callers to Get(true) wait until the presence
 	// is in initial sync state. This is to not make them early return
@@ -55,6 +62,15 @@ func (pres *RealtimePresence) verifyChanState() error {
 }
 
 func (pres *RealtimePresence) send(msg *PresenceMessage) (result, error) {
+	if err := pres.auth().checkCapability(pres.channel.Name, CapabilityPresence); err != nil {
+		return nil, err
+	}
+	// RTP8e: presence data is encoded and encrypted like message data.
+	encoded, err := msg.Message.withEncodedData(pres.channel.cipher())
+	if err != nil {
+		return nil, fmt.Errorf("encoding data for presence message: %w", err)
+	}
+	msg.Message = encoded
 	attached, err := pres.channel.attach()
 	if err != nil {
 		return nil, err
@@ -148,11 +164,19 @@ func (pres *RealtimePresence) syncEnd() {
 }
 
 func (pres *RealtimePresence) processIncomingMessage(msg *protocolMessage, syncSerial string) {
+	cipher := pres.channel.cipher()
 	for _, presmsg := range msg.Presence {
 		if presmsg.Timestamp == 0 {
 			presmsg.Timestamp = msg.Timestamp
 		}
+		var err error
+		presmsg.Message, err = presmsg.Message.withDecodedData(cipher)
+		if err != nil {
+			// RSL6b
+			pres.log().Errorf("Couldn't fully decode presence message data from channel %q: %v", pres.channel.Name, err)
+		}
 	}
+	connID := pres.channel.client.Connection.ID()
 	pres.mtx.Lock()
 	if syncSerial != "" {
 		pres.syncStart(syncSerial)
@@ -177,6 +201,17 @@ func (pres *RealtimePresence) processIncomingMessage(msg *protocolMessage, syncS
 		case PresenceActionLeave:
 			delete(pres.members, memberKey)
 		}
+		if member.ConnectionID == connID {
+			// RTP17b
+			switch member.Action {
+			case PresenceActionEnter, PresenceActionUpdate, PresenceActionPresent:
+				present := *member
+				present.Action = PresenceActionPresent
+				pres.internalMembers[memberKey] = &present
+			case PresenceActionLeave:
+				delete(pres.internalMembers, memberKey)
+			}
+		}
 		messages = append(messages, member)
 	}
 	if syncSerial == "" {
@@ -203,6 +238,56 @@ func (pres *RealtimePresence) processIncomingMessage(msg *protocolMessage, syncS
 	}
 }
 
+// enterInternalMembers re-enters the members entered by this connection,
+// after the channel has attached without resuming its previous presence
+// state (RTP17i). Failures are reported as an UPDATE event on the channel
+// (RTP17e).
+func (pres *RealtimePresence) enterInternalMembers() {
+	connID := pres.channel.client.Connection.ID()
+	pres.mtx.Lock()
+	members := make([]*PresenceMessage, 0, len(pres.internalMembers))
+	// If the connection has changed, the members are keyed by its new ID
+	// from now on, so that their re-entry replaces them.
+	internalMembers := make(map[string]*PresenceMessage, len(pres.internalMembers))
+	for _, member := range pres.internalMembers {
+		members = append(members, member)
+		rekeyed := *member
+		rekeyed.ConnectionID = connID
+		internalMembers[connID+member.ClientID] = &rekeyed
+	}
+	pres.internalMembers = internalMembers
+	pres.mtx.Unlock()
+
+	for _, member := range members {
+		msg := PresenceMessage{
+			Action: PresenceActionEnter,
+		}
+		// RTP17g. The data was decoded when the member was received, so
+		// its encoding doesn't apply anymore; send encodes it again.
+		msg.ID = member.ID
+		msg.ClientID = member.ClientID
+		msg.Data = member.Data
+		res, err := pres.send(&msg)
+		if err == nil {
+			err = res.Wait(context.Background())
+		}
+		if err != nil {
+			err = newError(ErrUnableToAutomaticallyReEnterPresenceChannel,
+				fmt.Errorf("re-entering member %q: %w", member.ClientID, err))
+			pres.log().Errorf("Couldn't re-enter presence on channel %q: %v", pres.channel.Name, err)
+			pres.channel.emitUpdate(err)
+		}
+	}
+}
+
+// clearInternalMembers forgets the members entered by this connection, once
+// the channel is no longer attached by choice or it fails (RTP5a).
+func (pres *RealtimePresence) clearInternalMembers() {
+	pres.mtx.Lock()
+	defer pres.mtx.Unlock()
+	pres.internalMembers = make(map[string]*PresenceMessage)
+}
+
 // Get returns a list of current members on the channel, attaching the channel
 // first is needed.
 //
@@ -226,8 +311,31 @@ func PresenceGetWithWaitForSync(wait bool) PresenceGetOption {
 	}
 }
 
+// PresenceGetWithClientID makes GetWithOptions return only the members with
+// the given client ID (RTP11c2).
+func PresenceGetWithClientID(clientID string) PresenceGetOption {
+	return func(o *presenceGetOptions) {
+		o.clientID = clientID
+	}
+}
+
+// PresenceGetWithConnectionID makes GetWithOptions return only the members
+// with the given connection ID (RTP11c3).
+func PresenceGetWithConnectionID(connectionID string) PresenceGetOption {
+	return func(o *presenceGetOptions) {
+		o.connectionID = connectionID
+	}
+}
+
 type presenceGetOptions struct {
-	waitForSync bool
+	waitForSync  bool
+	clientID     string
+	connectionID string
+}
+
+func (o *presenceGetOptions) matches(member *PresenceMessage) bool {
+	return (o.clientID == "" || member.ClientID == o.clientID) &&
+		(o.connectionID == "" || member.ConnectionID == o.connectionID)
 }
 
 func (o *presenceGetOptions) applyWithDefaults(options ...PresenceGetOption) {
@@ -260,11 +368,18 @@ func (pres *RealtimePresence) GetWithOptions(ctx context.Context, options ...Pre
 	defer pres.mtx.Unlock()
 	members := make([]*PresenceMessage, 0, len(pres.members))
 	for _, member := range pres.members {
-		members = append(members, member)
+		if opts.matches(member) {
+			members = append(members, member)
+		}
 	}
 	return members, nil
 }
 
+// History is equivalent to RESTPresence.History.
+func (pres *RealtimePresence) History(o ...PresenceHistoryOption) PresenceRequest {
+	return pres.channel.restChannel().Presence.History(o...)
+}
+
 type subscriptionPresenceMessage PresenceMessage
 
 func (*subscriptionPresenceMessage) isEmitterData() {}
@@ -3,8 +3,12 @@ package ably_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -166,3 +170,376 @@ func TestRealtimePresence_EnsureChannelIsAttached(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRealtimePresence_EncodeDecodeData(t *testing.T) {
+	key, err := ably.Crypto.GenerateRandomKey(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := ably.NewCBCCipher(ably.Crypto.GetDefaultParams(ably.CipherParams{Key: key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithClientID("client"),
+		ably.WithAutoConnect(false),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection-id",
+		ConnectionDetails: &ably.ConnectionDetails{ClientID: "client"},
+	}
+	err = ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("test", ably.ChannelWithCipherKey(key))
+
+	data := map[string]interface{}{"status": "online"}
+	entered := make(chan error, 1)
+	go func() {
+		entered <- channel.Presence.Enter(context.Background(), data)
+	}()
+
+	ablytest.Instantly.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+
+	var msg *ably.ProtocolMessage
+	ablytest.Soon.Recv(t, &msg, out, t.Fatalf)
+	if expected, got := ably.ActionPresence, msg.Action; expected != got {
+		t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+	}
+	sent := msg.Presence[0]
+	if expected, got := "json/utf-8/cipher+aes-256-cbc/base64", sent.Encoding; expected != got {
+		t.Fatalf("expected encoding %q; got %q", expected, got)
+	}
+	decoded, err := ably.MessageWithDecodedData(sent.Message, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, decoded.Data) {
+		t.Fatalf("expected %#v; got %#v", data, decoded.Data)
+	}
+
+	in <- &ably.ProtocolMessage{
+		Action:    ably.ActionAck,
+		MsgSerial: msg.MsgSerial,
+		Count:     1,
+	}
+	ablytest.Soon.Recv(t, &err, entered, t.Fatalf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presence := make(chan *ably.PresenceMessage, 1)
+	_, err = channel.Presence.SubscribeAll(context.Background(), func(m *ably.PresenceMessage) {
+		presence <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Echoed as PRESENT, which is stored as a member.
+	echoed := *sent
+	echoed.Action = ably.PresenceActionPresent
+	echoed.Timestamp = 1
+	in <- &ably.ProtocolMessage{
+		Action:   ably.ActionPresence,
+		Channel:  channel.Name,
+		Presence: []*ably.PresenceMessage{&echoed},
+	}
+
+	var received *ably.PresenceMessage
+	ablytest.Soon.Recv(t, &received, presence, t.Fatalf)
+	if !reflect.DeepEqual(data, received.Data) {
+		t.Fatalf("expected %#v; got %#v", data, received.Data)
+	}
+
+	members, err := channel.Presence.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || !reflect.DeepEqual(data, members[0].Data) {
+		t.Fatalf("expected a single member with data %#v; got %+v", data, members)
+	}
+}
+
+func TestRealtimePresence_RTP17_AutomaticReenter(t *testing.T) {
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+
+	in <- &ably.ProtocolMessage{
+		Action:       ably.ActionConnected,
+		ConnectionID: "connection-id",
+		// A wildcard client ID, to enter other clients with EnterClient.
+		ConnectionDetails: &ably.ConnectionDetails{ClientID: "*"},
+	}
+	err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("test")
+	go channel.Attach(context.Background())
+	ablytest.Instantly.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+		return channel.State() == ably.ChannelStateAttached
+	}), nil)
+
+	// Presence messages for this connection are kept in the internal
+	// members map, including those for other client IDs entered with
+	// EnterClient.
+	entered := &ably.PresenceMessage{Action: ably.PresenceActionEnter}
+	entered.ID = "connection-id:0:0"
+	entered.ClientID = "client"
+	entered.ConnectionID = "connection-id"
+	entered.Data = "data"
+	entered.Timestamp = 1
+	enteredClient := &ably.PresenceMessage{Action: ably.PresenceActionEnter}
+	enteredClient.ID = "connection-id:1:0"
+	enteredClient.ClientID = "bot"
+	enteredClient.ConnectionID = "connection-id"
+	enteredClient.Data = `{"status":"online"}`
+	enteredClient.Encoding = "json"
+	enteredClient.Timestamp = 1
+	other := &ably.PresenceMessage{Action: ably.PresenceActionEnter}
+	other.ClientID = "other"
+	other.ConnectionID = "other-connection-id"
+	other.Timestamp = 1
+	in <- &ably.ProtocolMessage{
+		Action:   ably.ActionPresence,
+		Channel:  channel.Name,
+		Presence: []*ably.PresenceMessage{entered, enteredClient, other},
+	}
+
+	stateChanges := make(ably.ChannelStateChanges, 10)
+	channel.OnAll(stateChanges.Receive)
+
+	// A resumed reattach keeps presence, so there's nothing to re-enter.
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+		Flags:   ably.FlagResumed,
+	}
+	ablytest.Soon.Recv(t, nil, stateChanges, t.Fatalf) // Consume UPDATE
+	ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
+
+	// RTP17i: a non-resumed reattach re-enters the members.
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+	ablytest.Soon.Recv(t, nil, stateChanges, t.Fatalf) // Consume UPDATE
+
+	// Members are re-entered one at a time, each once the previous one is
+	// ACKed.
+	var msg *ably.ProtocolMessage
+	reentered := map[string]*ably.PresenceMessage{}
+	for i := 0; i < 2; i++ {
+		ablytest.Soon.Recv(t, &msg, out, t.Fatalf)
+		if expected, got := ably.ActionPresence, msg.Action; expected != got {
+			t.Fatalf("expected %v; got %v (message: %+v)", expected, got, msg)
+		}
+		if expected, got := 1, len(msg.Presence); expected != got {
+			t.Fatalf("expected %d presence messages; got %d", expected, got)
+		}
+		m := msg.Presence[0]
+		if expected, got := ably.PresenceActionEnter, m.Action; expected != got {
+			t.Fatalf("expected %v; got %v", expected, got)
+		}
+		reentered[m.ClientID] = m
+		if i == 0 {
+			in <- &ably.ProtocolMessage{
+				Action:    ably.ActionAck,
+				MsgSerial: msg.MsgSerial,
+				Count:     1,
+			}
+		}
+	}
+	for _, c := range []struct {
+		clientID, id, data, encoding string
+	}{
+		{"client", "connection-id:0:0", "data", ""},
+		{"bot", "connection-id:1:0", `{"status":"online"}`, "json"},
+	} {
+		m, ok := reentered[c.clientID]
+		if !ok {
+			t.Fatalf("expected %q to be re-entered; got %+v", c.clientID, reentered)
+		}
+		// RTP17g
+		if expected, got := c.id, m.ID; expected != got {
+			t.Errorf("expected ID %q for %q; got %q", expected, c.clientID, got)
+		}
+		if m.Data != c.data || m.Encoding != c.encoding {
+			t.Errorf("expected data %q with encoding %q for %q; got %v with %q", c.data, c.encoding, c.clientID, m.Data, m.Encoding)
+		}
+	}
+	ablytest.Instantly.NoRecv(t, nil, out, t.Fatalf)
+
+	// RTP17e: a failed re-entry is reported as an UPDATE on the channel.
+	in <- &ably.ProtocolMessage{
+		Action:    ably.ActionNack,
+		MsgSerial: msg.MsgSerial,
+		Count:     1,
+		Error: &ably.ProtoErrorInfo{
+			StatusCode: 400,
+			Code:       40000,
+			Message:    "fake error",
+		},
+	}
+
+	var change ably.ChannelStateChange
+	ablytest.Soon.Recv(t, &change, stateChanges, t.Fatalf)
+	if expected, got := ably.ChannelEventUpdate, change.Event; expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+	if expected, got := ably.ErrUnableToAutomaticallyReEnterPresenceChannel, ably.UnwrapErrorCode(change.Reason); expected != got {
+		t.Fatalf("expected %v; got %v (event: %+v)", expected, got, change)
+	}
+}
+
+func TestRealtimePresence_RTP11c_GetWithFilters(t *testing.T) {
+	in := make(chan *ably.ProtocolMessage, 1)
+	out := make(chan *ably.ProtocolMessage, 16)
+
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithDial(MessagePipe(in, out)),
+	)
+
+	in <- &ably.ProtocolMessage{
+		Action:            ably.ActionConnected,
+		ConnectionID:      "connection-id",
+		ConnectionDetails: &ably.ConnectionDetails{},
+	}
+	err := ablytest.Wait(ablytest.ConnWaiter(c, c.Connect, ably.ConnectionEventConnected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := c.Channels.Get("test")
+	go channel.Attach(context.Background())
+	ablytest.Instantly.Recv(t, nil, out, t.Fatalf) // Consume ATTACH
+	in <- &ably.ProtocolMessage{
+		Action:  ably.ActionAttached,
+		Channel: channel.Name,
+	}
+
+	var members []*ably.PresenceMessage
+	for _, m := range []struct{ clientID, connectionID string }{
+		{"alice", "connection-1"},
+		{"alice", "connection-2"},
+		{"bob", "connection-1"},
+	} {
+		member := &ably.PresenceMessage{Action: ably.PresenceActionPresent}
+		member.ClientID = m.clientID
+		member.ConnectionID = m.connectionID
+		member.Timestamp = 1
+		members = append(members, member)
+	}
+	in <- &ably.ProtocolMessage{
+		Action:   ably.ActionPresence,
+		Channel:  channel.Name,
+		Presence: members,
+	}
+
+	err = ablytest.Wait(ablytest.AssertionWaiter(func() bool {
+		members, err := channel.Presence.Get(context.Background())
+		return err == nil && len(members) == 3
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		options  []ably.PresenceGetOption
+		expected []string
+	}{
+		{"client ID", []ably.PresenceGetOption{
+			ably.PresenceGetWithClientID("alice"),
+		}, []string{"alice/connection-1", "alice/connection-2"}},
+		{"connection ID", []ably.PresenceGetOption{
+			ably.PresenceGetWithConnectionID("connection-1"),
+		}, []string{"alice/connection-1", "bob/connection-1"}},
+		{"client and connection ID", []ably.PresenceGetOption{
+			ably.PresenceGetWithClientID("bob"),
+			ably.PresenceGetWithConnectionID("connection-1"),
+		}, []string{"bob/connection-1"}},
+		{"no match", []ably.PresenceGetOption{
+			ably.PresenceGetWithClientID("carol"),
+		}, []string{}},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			members, err := channel.Presence.GetWithOptions(context.Background(), c.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, m := range members {
+				got = append(got, m.ClientID+"/"+m.ConnectionID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(c.expected, got) {
+				t.Fatalf("expected %v; got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestRealtimePresence_History(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	client := &http.Client{
+		Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests <- req
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader("[]")),
+			}, nil
+		}),
+	}
+	c, _ := ably.NewRealtime(
+		ably.WithToken("fake:token"),
+		ably.WithAutoConnect(false),
+		ably.WithHTTPClient(client),
+	)
+
+	channel := c.Channels.Get("test")
+	_, err := channel.Presence.History(ably.PresenceHistoryWithLimit(10)).Pages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req *http.Request
+	ablytest.Instantly.Recv(t, &req, requests, t.Fatalf)
+	if expected, got := "/channels/test/presence/history", req.URL.Path; expected != got {
+		t.Fatalf("expected path %q; got %q", expected, got)
+	}
+	if expected, got := "10", req.URL.Query().Get("limit"); expected != got {
+		t.Fatalf("expected limit %q; got %q", expected, got)
+	}
+}
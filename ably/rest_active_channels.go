@@ -0,0 +1,189 @@
+package ably
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/ugorji/go/codec"
+)
+
+// ActiveChannels lists the app's active channels.
+//
+// Unless ActiveChannelsWithNamesOnly is set, each channel's details include
+// its status and occupancy, as given by RESTChannel.Status.
+func (c *REST) ActiveChannels(o ...ActiveChannelsOption) ActiveChannelsRequest {
+	var opts activeChannelsOptions
+	params := opts.apply(o...)
+	return ActiveChannelsRequest{
+		r:         c.newPaginatedRequest("/channels", params),
+		namesOnly: opts.namesOnly,
+	}
+}
+
+// An ActiveChannelsOption configures a call to REST.ActiveChannels.
+type ActiveChannelsOption func(*activeChannelsOptions)
+
+// ActiveChannelsWithPrefix lists only the channels whose names start with
+// prefix, e.g. "tenant-42:".
+func ActiveChannelsWithPrefix(prefix string) ActiveChannelsOption {
+	return func(o *activeChannelsOptions) {
+		o.params.Set("prefix", prefix)
+	}
+}
+
+// ActiveChannelsWithNamesOnly lists only the channels' names, which are set
+// as the ChannelID of their details, leaving their status unset.
+func ActiveChannelsWithNamesOnly() ActiveChannelsOption {
+	return func(o *activeChannelsOptions) {
+		o.namesOnly = true
+		o.params.Set("by", "id")
+	}
+}
+
+// ActiveChannelsWithLimit sets the size of the pages listed.
+func ActiveChannelsWithLimit(limit int) ActiveChannelsOption {
+	return func(o *activeChannelsOptions) {
+		o.params.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+type activeChannelsOptions struct {
+	params    url.Values
+	namesOnly bool
+}
+
+func (o *activeChannelsOptions) apply(opts ...ActiveChannelsOption) url.Values {
+	o.params = make(url.Values)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.params
+}
+
+// ActiveChannelsRequest represents a request prepared by the
+// REST.ActiveChannels method, ready to be performed by its Pages or Items
+// methods.
+type ActiveChannelsRequest struct {
+	r         paginatedRequest
+	namesOnly bool
+}
+
+// decoder returns the value to decode a page of results into dst, which is
+// either the channels' details or just their names.
+func (r ActiveChannelsRequest) decoder(dst *[]*ChannelDetails) interface{} {
+	if r.namesOnly {
+		return &channelNamesDecoder{dst: dst}
+	}
+	return dst
+}
+
+// Pages returns an iterator for whole pages of channel details.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r ActiveChannelsRequest) Pages(ctx context.Context) (*ActiveChannelsPaginatedResult, error) {
+	res := ActiveChannelsPaginatedResult{decoder: r.decoder}
+	return &res, res.load(ctx, r.r)
+}
+
+// An ActiveChannelsPaginatedResult is an iterator for the result of an
+// ActiveChannels request.
+//
+// See "Paginated results" section in the package-level documentation.
+type ActiveChannelsPaginatedResult struct {
+	PaginatedResult
+	items   []*ChannelDetails
+	decoder func(*[]*ChannelDetails) interface{}
+}
+
+// Next retrieves the next page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *ActiveChannelsPaginatedResult) Next(ctx context.Context) bool {
+	p.items = nil // avoid mutating already returned items
+	return p.next(ctx, p.decoder(&p.items))
+}
+
+// Items returns the current page of results.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *ActiveChannelsPaginatedResult) Items() []*ChannelDetails {
+	return p.items
+}
+
+// Items returns a convenience iterator for single channel details, over an
+// underlying paginated iterator.
+//
+// See "Paginated results" section in the package-level documentation.
+func (r ActiveChannelsRequest) Items(ctx context.Context) (*ActiveChannelsPaginatedItems, error) {
+	var res ActiveChannelsPaginatedItems
+	var err error
+	res.next, err = res.loadItems(ctx, r.r, func() (interface{}, func() int) {
+		res.items = nil // avoid mutating already returned items
+		return r.decoder(&res.items), func() int { return len(res.items) }
+	})
+	return &res, err
+}
+
+type ActiveChannelsPaginatedItems struct {
+	PaginatedResult
+	items []*ChannelDetails
+	item  *ChannelDetails
+	next  func(context.Context) (int, bool)
+}
+
+// Next retrieves the next result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *ActiveChannelsPaginatedItems) Next(ctx context.Context) bool {
+	i, ok := p.next(ctx)
+	if !ok {
+		return false
+	}
+	p.item = p.items[i]
+	return true
+}
+
+// Item returns the current result.
+//
+// See the "Paginated results" section in the package-level documentation.
+func (p *ActiveChannelsPaginatedItems) Item() *ChannelDetails {
+	return p.item
+}
+
+// channelNamesDecoder decodes a page of channel names into a destination
+// slice of channel details.
+type channelNamesDecoder struct {
+	dst *[]*ChannelDetails
+}
+
+func (d *channelNamesDecoder) UnmarshalJSON(b []byte) error {
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+	d.setNames(names)
+	return nil
+}
+
+func (d *channelNamesDecoder) CodecEncodeSelf(*codec.Encoder) {
+	panic("channelNamesDecoder cannot be used as encoder")
+}
+
+func (d *channelNamesDecoder) CodecDecodeSelf(decoder *codec.Decoder) {
+	var names []string
+	decoder.MustDecode(&names)
+	d.setNames(names)
+}
+
+var _ interface {
+	json.Unmarshaler
+	codec.Selfer
+} = (*channelNamesDecoder)(nil)
+
+func (d *channelNamesDecoder) setNames(names []string) {
+	for _, name := range names {
+		*d.dst = append(*d.dst, &ChannelDetails{ChannelID: name})
+	}
+}
@@ -0,0 +1,226 @@
+package ably
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ably/ably-go/ably/internal/ablyutil"
+)
+
+// BatchPublishSpec is a set of messages to publish on a set of channels with
+// REST.BatchPublish.
+type BatchPublishSpec struct {
+	Channels []string
+	Messages []*Message
+}
+
+// BatchPublishResult is the result of publishing the messages of a
+// BatchPublishSpec on one of its channels.
+type BatchPublishResult struct {
+	Channel string
+	// MessageID is the prefix of the IDs Ably assigned to the published
+	// messages, which are MessageID:0, MessageID:1 and so on.
+	MessageID string
+	// Error is the reason the messages couldn't be published on the channel,
+	// if so; MessageID is then unset.
+	Error *ErrorInfo
+}
+
+type batchPublishSpec struct {
+	Channels []string  `json:"channels" codec:"channels"`
+	Messages []Message `json:"messages" codec:"messages"`
+}
+
+type batchPublishResult struct {
+	Channel   string     `json:"channel" codec:"channel"`
+	MessageID string     `json:"messageId,omitempty" codec:"messageId,omitempty"`
+	Error     *errorInfo `json:"error,omitempty" codec:"error,omitempty"`
+}
+
+type batchPublishResponse struct {
+	BatchResponse []batchPublishResult `json:"batchResponse" codec:"batchResponse"`
+}
+
+// BatchPublish publishes the messages of each spec on each of its channels,
+// in a single request.
+//
+// Messages are encoded as RESTChannel.Publish does, including encrypting them
+// with the cipher of each channel previously got from c.Channels with one.
+// Messages without an ID are given one if IdempotentRESTPublishing is set, so
+// that publishing them again on failure doesn't duplicate them.
+//
+// The results hold whether the messages were published on each channel. If
+// only some of them failed, the reasons are set in the results' Error, and the
+// returned error is nil.
+func (c *REST) BatchPublish(ctx context.Context, specs []BatchPublishSpec) ([]BatchPublishResult, error) {
+	var results []BatchPublishResult
+	var body []batchPublishSpec
+	for i, spec := range specs {
+		if len(spec.Channels) == 0 || len(spec.Messages) == 0 {
+			return nil, newErrorf(ErrBadRequest, "batch spec #%d has no channels or messages", i)
+		}
+		var idBase string
+		if c.opts.idempotentRESTPublishing() {
+			var err error
+			if idBase, err = batchMessageIDBase(spec.Messages); err != nil {
+				return nil, err
+			}
+		}
+
+		// Messages are encrypted differently for each cipher, so channels
+		// are grouped by cipher, each group in a spec of its own.
+		var ciphers []channelCipher
+		groups := map[channelCipher]*batchPublishSpec{}
+		for _, name := range spec.Channels {
+			if err := c.Auth.checkCapability(name, CapabilityPublish); err != nil {
+				results = append(results, BatchPublishResult{Channel: name, Error: err.(*ErrorInfo)})
+				continue
+			}
+			cipher, _ := c.Channels.lookup(name).options.GetCipher()
+			group, ok := groups[cipher]
+			if !ok {
+				group = &batchPublishSpec{}
+				for j, m := range spec.Messages {
+					encoded, err := (*m).withEncodedData(cipher)
+					if err != nil {
+						return nil, fmt.Errorf("encoding data for message #%d of batch spec #%d: %w", j, i, err)
+					}
+					if idBase != "" {
+						encoded.ID = fmt.Sprintf("%s:%d", idBase, j)
+					}
+					group.Messages = append(group.Messages, encoded)
+				}
+				groups[cipher] = group
+				ciphers = append(ciphers, cipher)
+			}
+			group.Channels = append(group.Channels, name)
+		}
+		for _, cipher := range ciphers {
+			body = append(body, *groups[cipher])
+		}
+	}
+	if len(body) == 0 {
+		return results, nil
+	}
+
+	var res batchPublishResponse
+	r := &request{
+		Method: "POST",
+		Path:   "/messages",
+		In:     body,
+		Out:    &res,
+	}
+	// A successful response is just the results; one that failed for only
+	// some channels holds them in batchResponse, along with the error.
+	handle := func(resp *http.Response, out interface{}) (*http.Response, error) {
+		if resp.StatusCode < 300 {
+			return c.handleResponse(resp, &res.BatchResponse)
+		}
+		return c.handleBatchResponse(resp, out)
+	}
+	if _, err := c.doWithHandle(ctx, r, handle); err != nil {
+		return nil, err
+	}
+	for _, r := range res.BatchResponse {
+		result := BatchPublishResult{Channel: r.Channel, MessageID: r.MessageID}
+		if r.Error != nil {
+			result.Error = newErrorFromProto(r.Error)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// BatchPresenceResult is the presence of one of the channels queried with
+// REST.BatchPresence.
+type BatchPresenceResult struct {
+	Channel string
+	// Presence holds the members present on the channel.
+	Presence []*PresenceMessage
+	// Error is the reason the presence of the channel couldn't be got, if so.
+	Error *ErrorInfo
+}
+
+type batchPresenceResult struct {
+	Channel  string             `json:"channel" codec:"channel"`
+	Presence []*PresenceMessage `json:"presence,omitempty" codec:"presence,omitempty"`
+	Error    *errorInfo         `json:"error,omitempty" codec:"error,omitempty"`
+}
+
+type batchPresenceResponse struct {
+	BatchResponse []batchPresenceResult `json:"batchResponse" codec:"batchResponse"`
+}
+
+// BatchPresence gets the members present on each of the channels, in a single
+// request.
+//
+// Presence messages are decoded as RESTPresence.Get does, including
+// decrypting them with the cipher of each channel previously got from
+// c.Channels with one.
+//
+// If the presence of only some channels can't be got, the reasons are set in
+// the results' Error, and the returned error is nil.
+func (c *REST) BatchPresence(ctx context.Context, channels []string) ([]BatchPresenceResult, error) {
+	if len(channels) == 0 {
+		return nil, newErrorf(ErrBadRequest, "no channels to get presence for")
+	}
+	var res batchPresenceResponse
+	r := &request{
+		Method: "GET",
+		Path:   "/presence?" + url.Values{"channels": {strings.Join(channels, ",")}}.Encode(),
+		Out:    &res,
+	}
+	// As with BatchPublish, only a response for a partial failure wraps the
+	// results.
+	handle := func(resp *http.Response, out interface{}) (*http.Response, error) {
+		if resp.StatusCode < 300 {
+			return c.handleResponse(resp, &res.BatchResponse)
+		}
+		return c.handleBatchResponse(resp, out)
+	}
+	if _, err := c.doWithHandle(ctx, r, handle); err != nil {
+		return nil, err
+	}
+	results := make([]BatchPresenceResult, 0, len(res.BatchResponse))
+	for _, r := range res.BatchResponse {
+		result := BatchPresenceResult{Channel: r.Channel}
+		if r.Error != nil {
+			result.Error = newErrorFromProto(r.Error)
+		} else {
+			decoder := fullPresenceDecoder{dst: &r.Presence, c: c.Channels.lookup(r.Channel)}
+			decoder.decodeMessagesData()
+			result.Presence = r.Presence
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// batchMessageIDBase returns the base of the IDs for idempotent publishing
+// of messages, which are base:0, base:1 and so on as with
+// RESTChannel.PublishMultiple, or "" if some of them already have one. The IDs
+// are set on the messages' encoded copies, so that the same messages
+// published again are given new ones.
+func batchMessageIDBase(messages []*Message) (string, error) {
+	for _, m := range messages {
+		if m.ID != "" {
+			return "", nil
+		}
+	}
+	return ablyutil.BaseID()
+}
+
+// lookup returns the channel if it exists, or else a new one with no options
+// that isn't added to the channels.
+func (c *RESTChannels) lookup(name string) *RESTChannel {
+	c.mu.RLock()
+	ch, ok := c.chans[name]
+	c.mu.RUnlock()
+	if !ok {
+		return newRESTChannel(name, c.client)
+	}
+	return ch
+}
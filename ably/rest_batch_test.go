@@ -0,0 +1,235 @@
+package ably_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ably/ably-go/ably"
+)
+
+func TestREST_BatchPublish(t *testing.T) {
+	type spec struct {
+		Channels []string
+		Messages []struct {
+			ID       string
+			Name     string
+			Data     string
+			Encoding string
+		}
+	}
+	var requests [][]spec
+	respond := func(status int, body string) ably.ClientOption {
+		return ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				var specs []spec
+				if err := json.NewDecoder(req.Body).Decode(&specs); err != nil {
+					return nil, err
+				}
+				requests = append(requests, specs)
+				return &http.Response{
+					StatusCode: status,
+					Header:     http.Header{"Content-Type": {"application/json"}},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				}, nil
+			}),
+		})
+	}
+
+	t.Run("partial failure", func(t *testing.T) {
+		requests = nil
+		client, err := ably.NewREST(
+			ably.WithKey("app.key:secret"),
+			ably.WithUseBinaryProtocol(false),
+			ably.WithIdempotentRESTPublishing(true),
+			respond(http.StatusBadRequest, `{
+				"error": {"code": 40020, "statusCode": 400, "message": "Batched response includes errors"},
+				"batchResponse": [
+					{"channel": "users:alice", "messageId": "abc"},
+					{"channel": "users:bob", "error": {"code": 40160, "statusCode": 401, "message": "not permitted"}},
+					{"channel": "secret", "messageId": "abc"}
+				]
+			}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := make([]byte, 16)
+		client.Channels.Get("secret", ably.ChannelWithCipherKey(key))
+
+		messages := []*ably.Message{
+			{Name: "event", Data: "hello"},
+			{Name: "event", Data: "world"},
+		}
+		batch := []ably.BatchPublishSpec{{
+			Channels: []string{"users:alice", "users:bob", "secret"},
+			Messages: messages,
+		}}
+		results, err := client.BatchPublish(context.Background(), batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(requests) != 1 {
+			t.Fatalf("expected 1 request; got %d", len(requests))
+		}
+		specs := requests[0]
+		if len(specs) != 2 {
+			t.Fatalf("expected a spec for the encrypted channel; got %+v", specs)
+		}
+		if expected, got := "users:alice,users:bob", strings.Join(specs[0].Channels, ","); expected != got {
+			t.Errorf("expected channels %s; got %s", expected, got)
+		}
+		if expected, got := "secret", strings.Join(specs[1].Channels, ","); expected != got {
+			t.Errorf("expected channels %s; got %s", expected, got)
+		}
+		idPattern := regexp.MustCompile(`^[A-Za-z0-9+/]+:(\d)$`)
+		for i, m := range specs[0].Messages {
+			if m.Data != []string{"hello", "world"}[i] || m.Encoding != "" {
+				t.Errorf("unexpected plain message: %+v", m)
+			}
+			if match := idPattern.FindStringSubmatch(m.ID); match == nil || match[1] != []string{"0", "1"}[i] {
+				t.Errorf("unexpected ID for message #%d: %+v", i, m)
+			}
+			if encrypted := specs[1].Messages[i]; encrypted.ID != m.ID || !strings.Contains(encrypted.Encoding, "cipher+aes-128-cbc") {
+				t.Errorf("expected message #%d encrypted with the same ID; got %+v", i, encrypted)
+			}
+		}
+
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results; got %+v", results)
+		}
+		if r := results[0]; r.Channel != "users:alice" || r.MessageID != "abc" || r.Error != nil {
+			t.Errorf("unexpected success result: %+v", r)
+		}
+		if r := results[1]; r.Channel != "users:bob" || r.Error == nil || r.Error.Code != 40160 {
+			t.Errorf("unexpected failure result: %+v", r)
+		}
+
+		// IDs are set on copies, so publishing the same messages again gives
+		// them new ones instead of having them deduplicated.
+		for i, m := range messages {
+			if m.ID != "" {
+				t.Errorf("expected message #%d to be left without ID; got %q", i, m.ID)
+			}
+		}
+		if _, err := client.BatchPublish(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+		if len(requests) != 2 {
+			t.Fatalf("expected 2 requests; got %d", len(requests))
+		}
+		if first, again := specs[0].Messages[0].ID, requests[1][0].Messages[0].ID; first == again {
+			t.Errorf("expected a new ID publishing again; got %q both times", again)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		requests = nil
+		client, err := ably.NewREST(
+			ably.WithKey("app.key:secret"),
+			ably.WithUseBinaryProtocol(false),
+			respond(http.StatusCreated, `[{"channel": "a", "messageId": "x"}, {"channel": "b", "messageId": "y"}]`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := client.BatchPublish(context.Background(), []ably.BatchPublishSpec{
+			{Channels: []string{"a"}, Messages: []*ably.Message{{ID: "own", Data: "1"}}},
+			{Channels: []string{"b"}, Messages: []*ably.Message{{Data: "2"}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requests) != 1 || len(requests[0]) != 2 {
+			t.Fatalf("expected a request with 2 specs; got %+v", requests)
+		}
+		if expected, got := "own", requests[0][0].Messages[0].ID; expected != got {
+			t.Errorf("expected ID %q; got %q", expected, got)
+		}
+		if got := requests[0][1].Messages[0].ID; got != "" {
+			t.Errorf("expected no ID without idempotent publishing; got %q", got)
+		}
+		if len(results) != 2 || results[0].MessageID != "x" || results[1].MessageID != "y" {
+			t.Errorf("unexpected results: %+v", results)
+		}
+	})
+
+	t.Run("request failure", func(t *testing.T) {
+		client, err := ably.NewREST(
+			ably.WithKey("app.key:secret"),
+			ably.WithUseBinaryProtocol(false),
+			respond(http.StatusUnauthorized, `{"error": {"code": 40101, "statusCode": 401, "message": "invalid credentials"}}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.BatchPublish(context.Background(), []ably.BatchPublishSpec{
+			{Channels: []string{"a"}, Messages: []*ably.Message{{Data: "1"}}},
+		})
+		if expected, got := ably.ErrorCode(40101), ably.UnwrapErrorCode(err); expected != got {
+			t.Errorf("expected error code %d; got %v", expected, err)
+		}
+	})
+}
+
+func TestREST_BatchPresence(t *testing.T) {
+	var query string
+	client, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				query = req.URL.Path + "?" + req.URL.RawQuery
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Header:     http.Header{"Content-Type": {"application/json"}},
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"error": {"code": 40020, "statusCode": 400, "message": "Batched response includes errors"},
+						"batchResponse": [
+							{"channel": "room:1", "presence": [
+								{"clientId": "alice", "action": 1, "data": "{\"status\":\"away\"}", "encoding": "json"}
+							]},
+							{"channel": "room:2", "error": {"code": 40160, "statusCode": 401, "message": "not permitted"}}
+						]
+					}`)),
+				}, nil
+			}),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := client.BatchPresence(context.Background(), []string{"room:1", "room:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "/presence?channels=room%3A1%2Croom%3A2", query; expected != got {
+		t.Errorf("expected request %s; got %s", expected, got)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results; got %+v", results)
+	}
+	if r := results[0]; r.Channel != "room:1" || r.Error != nil || len(r.Presence) != 1 {
+		t.Fatalf("unexpected success result: %+v", r)
+	}
+	m := results[0].Presence[0]
+	if expected, got := "alice", m.ClientID; expected != got {
+		t.Errorf("expected client ID %q; got %q", expected, got)
+	}
+	if expected, got := map[string]interface{}{"status": "away"}, m.Data; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected decoded data %v; got %v", expected, got)
+	}
+	if r := results[1]; r.Channel != "room:2" || r.Error == nil || r.Error.Code != 40160 {
+		t.Errorf("unexpected failure result: %+v", r)
+	}
+	if client.Channels.Exists("room:1") {
+		t.Errorf("expected BatchPresence not to create channels")
+	}
+}
@@ -3,6 +3,7 @@ package ably
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -84,6 +85,9 @@ func (c *RESTChannel) PublishMultipleWithOptions(ctx context.Context, messages [
 	for _, o := range options {
 		o(&publishOpts)
 	}
+	if err := c.client.Auth.checkCapability(c.Name, CapabilityPublish); err != nil {
+		return err
+	}
 	for i, m := range messages {
 		cipher, _ := c.options.GetCipher()
 		var err error
@@ -138,9 +142,33 @@ func (c *RESTChannel) PublishMultipleWithOptions(ctx context.Context, messages [
 	return res.Body.Close()
 }
 
+// Status gets the channel's details, including whether it's active and its
+// occupancy.
+func (c *RESTChannel) Status(ctx context.Context) (*ChannelDetails, error) {
+	if err := c.client.Auth.checkCapability(c.Name, CapabilityChannelMetadata); err != nil {
+		return nil, err
+	}
+	var details ChannelDetails
+	if _, err := c.client.get(ctx, c.baseURL, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
 // History gives the channel's message history.
+//
+// HistoryWithUntilAttach isn't supported; it makes the request fail.
 func (c *RESTChannel) History(o ...HistoryOption) HistoryRequest {
-	params := (&historyOptions{}).apply(o...)
+	var opts historyOptions
+	params := opts.apply(o...)
+	req := c.history(params)
+	if opts.untilAttach {
+		req.err = newError(ErrBadRequest, errors.New("untilAttach is only supported by realtime channels"))
+	}
+	return req
+}
+
+func (c *RESTChannel) history(params url.Values) HistoryRequest {
 	return HistoryRequest{
 		r:       c.client.newPaginatedRequest("/channels/"+c.Name+"/history", params),
 		channel: c,
@@ -174,8 +202,19 @@ func HistoryWithDirection(d Direction) HistoryOption {
 	}
 }
 
+// HistoryWithUntilAttach makes RealtimeChannel.History return only messages
+// published up to the point the channel attached, so that they can be
+// combined with the messages received since without gaps or duplicates
+// (RTL10b). The channel must be attached.
+func HistoryWithUntilAttach() HistoryOption {
+	return func(o *historyOptions) {
+		o.untilAttach = true
+	}
+}
+
 type historyOptions struct {
-	params url.Values
+	params      url.Values
+	untilAttach bool
 }
 
 func (o *historyOptions) apply(opts ...HistoryOption) url.Values {
@@ -191,12 +230,16 @@ func (o *historyOptions) apply(opts ...HistoryOption) url.Values {
 type HistoryRequest struct {
 	r       paginatedRequest
 	channel *RESTChannel
+	err     error
 }
 
 // Pages returns an iterator for whole pages of History.
 //
 // See "Paginated results" section in the package-level documentation.
 func (r HistoryRequest) Pages(ctx context.Context) (*MessagesPaginatedResult, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
 	var res MessagesPaginatedResult
 	return &res, res.load(ctx, r.r)
 }
@@ -229,6 +272,9 @@ func (p *MessagesPaginatedResult) Items() []*Message {
 //
 // See "Paginated results" section in the package-level documentation.
 func (r HistoryRequest) Items(ctx context.Context) (*MessagesPaginatedItems, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
 	var res MessagesPaginatedItems
 	var err error
 	res.next, err = res.loadItems(ctx, r.r, func() (interface{}, func() int) {
@@ -282,7 +328,7 @@ func (t *fullMessagesDecoder) decodeMessagesData() {
 		*m, err = m.withDecodedData(cipher)
 		if err != nil {
 			// RSL6b
-			t.c.log().Errorf("Couldn't fully decode message data from channel %q: %w", t.c.Name, err)
+			t.c.log().Errorf("Couldn't fully decode message data from channel %q: %v", t.c.Name, err)
 		}
 	}
 }
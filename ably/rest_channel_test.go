@@ -470,3 +470,65 @@ func TestIdempotent_retry(t *testing.T) {
 		})
 	})
 }
+
+func TestRESTChannel_Status(t *testing.T) {
+	var path string
+	client, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				path = req.URL.EscapedPath()
+				rec := httptest.NewRecorder()
+				rec.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(rec, `{
+					"channelId": "room:1",
+					"status": {
+						"isActive": true,
+						"occupancy": {
+							"metrics": {
+								"connections": 5,
+								"publishers": 2,
+								"subscribers": 4,
+								"presenceConnections": 3,
+								"presenceMembers": 2,
+								"presenceSubscribers": 1
+							}
+						}
+					}
+				}`)
+				return rec.Result(), nil
+			}),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := client.Channels.Get("room:1").Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "/channels/room%3A1", path; expected != got {
+		t.Errorf("expected path %s; got %s", expected, got)
+	}
+	expected := &ably.ChannelDetails{
+		ChannelID: "room:1",
+		Status: ably.ChannelStatus{
+			IsActive: true,
+			Occupancy: ably.ChannelOccupancy{
+				Metrics: ably.ChannelMetrics{
+					Connections:         5,
+					Publishers:          2,
+					Subscribers:         4,
+					PresenceConnections: 3,
+					PresenceMembers:     2,
+					PresenceSubscribers: 1,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(expected, details) {
+		t.Errorf("expected %+v; got %+v", expected, details)
+	}
+}
@@ -107,6 +107,7 @@ func (c *RESTChannels) Release(name string) {
 type REST struct {
 	Auth                *Auth
 	Channels            *RESTChannels
+	Push                *Push
 	opts                *clientOptions
 	successFallbackHost *fallbackCache
 	log                 logger
@@ -130,6 +131,7 @@ func NewREST(options ...ClientOption) (*REST, error) {
 		chans:  make(map[string]*RESTChannel),
 		client: c,
 	}
+	c.Push = newPush(c)
 	c.successFallbackHost = &fallbackCache{
 		duration: c.opts.fallbackRetryTimeout(),
 	}
@@ -726,6 +728,32 @@ func (c *REST) handleResponse(resp *http.Response, out interface{}) (*http.Respo
 	return resp, nil
 }
 
+// handleBatchResponse is like handleResponse, but a response to a batch
+// request that failed for only some of its items is decoded into out too,
+// instead of being returned as an error, since it holds the results for
+// every item.
+func (c *REST) handleBatchResponse(resp *http.Response, out interface{}) (*http.Response, error) {
+	if resp.StatusCode < 300 {
+		return c.handleResponse(resp, out)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, newError(ErrInternalError, err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := checkValidHTTPResponse(resp); code(err) != ErrBatchError {
+		c.log.Error("RestClient: failed to check valid http response ", err)
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := decodeResp(resp, out); err != nil {
+		c.log.Error("RestClient: failed to decode batch response ", err)
+		return nil, err
+	}
+	return resp, nil
+}
+
 func encode(typ string, in interface{}) ([]byte, error) {
 	switch typ {
 	case "application/json":
@@ -839,3 +839,86 @@ var (
 func intervalFormatFor(t time.Time, granularity string) string {
 	return t.Format(intervalFormats[granularity])
 }
+
+func TestREST_ActiveChannels(t *testing.T) {
+	pages := map[string]struct {
+		link string
+		body string
+	}{
+		"by=id&prefix=tenant-42%3A": {
+			link: `<./channels?by=id&cursor=abc&prefix=tenant-42%3A>; rel="next"`,
+			body: `["tenant-42:a", "tenant-42:b"]`,
+		},
+		"by=id&cursor=abc&prefix=tenant-42%3A": {
+			body: `["tenant-42:c"]`,
+		},
+		"prefix=tenant-42%3A": {
+			body: `[{"channelId": "tenant-42:a", "status": {"isActive": true, "occupancy": {"metrics": {"connections": 3}}}}]`,
+		},
+	}
+	client, err := ably.NewREST(
+		ably.WithKey("app.key:secret"),
+		ably.WithUseBinaryProtocol(false),
+		ably.WithHTTPClient(&http.Client{
+			Transport: httpRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.Path != "/channels" {
+					return nil, fmt.Errorf("unexpected path %s", req.URL.Path)
+				}
+				page, ok := pages[req.URL.RawQuery]
+				if !ok {
+					return nil, fmt.Errorf("unexpected query %s", req.URL.RawQuery)
+				}
+				rec := httptest.NewRecorder()
+				rec.Header().Set("Content-Type", "application/json")
+				if page.link != "" {
+					rec.Header().Set("Link", page.link)
+				}
+				fmt.Fprint(rec, page.body)
+				return rec.Result(), nil
+			}),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("names only", func(t *testing.T) {
+		items, err := client.ActiveChannels(
+			ably.ActiveChannelsWithPrefix("tenant-42:"),
+			ably.ActiveChannelsWithNamesOnly(),
+		).Items(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for items.Next(context.Background()) {
+			names = append(names, items.Item().ChannelID)
+		}
+		if err := items.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := []string{"tenant-42:a", "tenant-42:b", "tenant-42:c"}, names; !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v; got %v", expected, got)
+		}
+	})
+
+	t.Run("details", func(t *testing.T) {
+		pages, err := client.ActiveChannels(ably.ActiveChannelsWithPrefix("tenant-42:")).Pages(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pages.Next(context.Background()) {
+			t.Fatal(pages.Err())
+		}
+		items := pages.Items()
+		if len(items) != 1 {
+			t.Fatalf("expected 1 channel; got %+v", items)
+		}
+		if d := items[0]; d.ChannelID != "tenant-42:a" || !d.Status.IsActive || d.Status.Occupancy.Metrics.Connections != 3 {
+			t.Errorf("unexpected details: %+v", d)
+		}
+		if pages.Next(context.Background()) {
+			t.Errorf("expected a single page")
+		}
+	})
+}
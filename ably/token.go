@@ -110,8 +110,17 @@ func (tok *TokenDetails) ExpireTime() time.Time {
 	return time.Unix(tok.Expires/1000, tok.Expires%1000*int64(time.Millisecond))
 }
 
+// newTokenDetails returns the TokenDetails for a token string. If it's a
+// JWT, the details are taken from its claims.
 func newTokenDetails(token string) *TokenDetails {
-	return &TokenDetails{
+	tok := &TokenDetails{
 		Token: token,
 	}
+	if claims, ok := parseJWT(token); ok {
+		tok.Issued = claims.IssuedAt * 1000
+		tok.Expires = claims.ExpiresAt * 1000
+		tok.Capability = claims.Capability
+		tok.ClientID = claims.ClientID
+	}
+	return tok
 }
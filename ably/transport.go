@@ -0,0 +1,92 @@
+package ably
+
+import (
+	"bytes"
+	"net/url"
+	"time"
+)
+
+// Transport dials the connections that Realtime clients exchange protocol
+// messages with Ably through.
+//
+// The library dials through a websocket transport by default. A custom
+// Transport can be set with WithTransport to, for instance, instrument
+// connections or exchange messages through an in-memory stand-in for Ably in
+// tests.
+type Transport interface {
+	// Dial opens a connection to the given realtime URL.
+	//
+	// protocol is the MIME type of the protocol messages' encoding, either
+	// "application/json" or "application/x-msgpack". The URL's format query
+	// parameter is set accordingly.
+	//
+	// If the connection can't be opened before timeout, Dial should fail with
+	// a net.Error with Timeout() == true.
+	Dial(protocol string, u *url.URL, timeout time.Duration) (TransportConn, error)
+}
+
+// TransportFunc is a function that implements Transport.
+type TransportFunc func(protocol string, u *url.URL, timeout time.Duration) (TransportConn, error)
+
+// Dial implements Transport.
+func (f TransportFunc) Dial(protocol string, u *url.URL, timeout time.Duration) (TransportConn, error) {
+	return f(protocol, u, timeout)
+}
+
+// TransportConn is a connection opened by a Transport. It exchanges frames
+// which each hold a single protocol message, encoded with the protocol the
+// connection was dialed with.
+type TransportConn interface {
+	// Send writes a frame to the connection.
+	// It is expected to block until the whole frame is written.
+	Send(frame []byte) error
+
+	// Receive reads a frame from the connection.
+	// It is expected to block until the whole frame is read.
+	//
+	// If the deadline is greater than zero and no frame is received before
+	// then, a net.Error with Timeout() == true is returned.
+	Receive(deadline time.Time) ([]byte, error)
+
+	// Close closes the connection.
+	Close() error
+}
+
+// transportConn is a conn that exchanges protocol messages through a
+// TransportConn, encoded with the given protocol.
+type transportConn struct {
+	conn  TransportConn
+	proto string
+}
+
+func dialTransport(t Transport, proto string, u *url.URL, timeout time.Duration) (conn, error) {
+	c, err := t.Dial(proto, u, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return transportConn{conn: c, proto: proto}, nil
+}
+
+func (c transportConn) Send(msg *protocolMessage) error {
+	frame, err := encode(c.proto, msg)
+	if err != nil {
+		return err
+	}
+	return c.conn.Send(frame)
+}
+
+func (c transportConn) Receive(deadline time.Time) (*protocolMessage, error) {
+	frame, err := c.conn.Receive(deadline)
+	if err != nil {
+		return nil, err
+	}
+	msg := &protocolMessage{}
+	if err := decode(c.proto, bytes.NewReader(frame), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c transportConn) Close() error {
+	return c.conn.Close()
+}
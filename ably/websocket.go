@@ -1,84 +1,91 @@
 package ably
 
 import (
+	"context"
 	"errors"
-	"net"
+	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
-	"github.com/ably/ably-go/ably/internal/ablyutil"
-	"golang.org/x/net/websocket"
+	"github.com/ably/ably-go/ably/internal/websocket"
 )
 
+// WebsocketCloseError is the cause of a connection error when Ably closes the
+// websocket connection, with the close code and reason from its close frame.
+//
+// It can be retrieved from a ConnectionStateChange's Reason with errors.As.
+type WebsocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebsocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+// websocketTransport returns the default Transport, which dials websocket
+// connections with the client's options.
+func websocketTransport(opts *clientOptions) Transport {
+	return TransportFunc(func(proto string, u *url.URL, timeout time.Duration) (TransportConn, error) {
+		return dialWebsocket(proto, u, timeout, websocket.DialOptions{
+			Proxy:       opts.proxy(),
+			TLSConfig:   opts.TLSConfig,
+			Compression: true,
+		})
+	})
+}
+
 type websocketConn struct {
-	conn  *websocket.Conn
-	codec websocket.Codec
+	conn *websocket.Conn
+	typ  websocket.MessageType
 }
 
-func (ws *websocketConn) Send(msg *protocolMessage) error {
-	return ws.codec.Send(ws.conn, msg)
+func (ws *websocketConn) Send(frame []byte) error {
+	return ws.conn.WriteMessage(ws.typ, frame)
 }
 
-func (ws *websocketConn) Receive(deadline time.Time) (*protocolMessage, error) {
-	msg := &protocolMessage{}
+func (ws *websocketConn) Receive(deadline time.Time) ([]byte, error) {
 	if !deadline.IsZero() {
 		err := ws.conn.SetReadDeadline(deadline)
 		if err != nil {
 			return nil, err
 		}
 	}
-	err := ws.codec.Receive(ws.conn, &msg)
+	_, frame, err := ws.conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return nil, &WebsocketCloseError{Code: closeErr.Code, Reason: closeErr.Reason}
+	}
 	if err != nil {
 		return nil, err
 	}
-	return msg, nil
+	return frame, nil
 }
 
 func (ws *websocketConn) Close() error {
 	return ws.conn.Close()
 }
 
-func dialWebsocket(proto string, u *url.URL, timeout time.Duration) (*websocketConn, error) {
+func dialWebsocket(proto string, u *url.URL, timeout time.Duration, opts websocket.DialOptions) (TransportConn, error) {
 	ws := &websocketConn{}
 	switch proto {
-	case "application/json":
-		ws.codec = websocket.JSON
-	case "application/x-msgpack":
-		ws.codec = msgpackCodec
+	case protocolJSON:
+		ws.typ = websocket.TextMessage
+	case protocolMsgPack:
+		ws.typ = websocket.BinaryMessage
 	default:
 		return nil, errors.New(`invalid protocol "` + proto + `"`)
 	}
-	// Starts a raw websocket connection with server
-	conn, err := dialWebsocketTimeout(u.String(), "", "https://"+u.Host, timeout)
+	opts.Header = http.Header{}
+	opts.Header.Set(ablyAgentHeader, ablyAgentIdentifier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, u.String(), opts)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("dialing websocket to %s: %w", u.Host, err)
 	}
 	ws.conn = conn
 	return ws, nil
 }
-
-// dialWebsocketTimeout dials the websocket with a timeout.
-func dialWebsocketTimeout(uri, protocol, origin string, timeout time.Duration) (*websocket.Conn, error) {
-	config, err := websocket.NewConfig(uri, origin)
-	if err != nil {
-		return nil, err
-	}
-	config.Header.Set(ablyAgentHeader, ablyAgentIdentifier)
-	if protocol != "" {
-		config.Protocol = []string{protocol}
-	}
-	config.Dialer = &net.Dialer{
-		Timeout: timeout,
-	}
-	return websocket.DialConfig(config)
-}
-
-var msgpackCodec = websocket.Codec{
-	Marshal: func(v interface{}) ([]byte, byte, error) {
-		p, err := ablyutil.MarshalMsgpack(v)
-		return p, websocket.BinaryFrame, err
-	},
-	Unmarshal: func(p []byte, _ byte, v interface{}) error {
-		return ablyutil.UnmarshalMsgpack(p, v)
-	},
-}